@@ -15,6 +15,9 @@ import (
 	"seller-pages/internal/models"
 )
 
+// actAsHeader lets a teacher work with a student's sandbox.
+const actAsHeader = "X-Act-As"
+
 var (
 	errNicknameIsEmpty      = errors.New("nickname is empty")
 	errUnauthorized         = errors.New("unauthorized")
@@ -22,8 +25,14 @@ var (
 	errInvalidSigningMethod = errors.New("invalid signing method")
 )
 
+// SandboxDirectory tells which students have sandboxes, teachers may act only as them.
+type SandboxDirectory interface {
+	HasSandbox(nickname string) bool
+}
+
 type AuthMiddleware struct {
 	publicKey *rsa.PublicKey
+	sandboxes SandboxDirectory
 
 	logger        *zap.SugaredLogger
 	revokedTokens map[string]struct{}
@@ -31,6 +40,7 @@ type AuthMiddleware struct {
 
 func NewAuthMiddleware(
 	publicKey *rsa.PublicKey,
+	sandboxes SandboxDirectory,
 	logger *zap.SugaredLogger,
 	revokedTokensList []string,
 ) *AuthMiddleware {
@@ -41,6 +51,7 @@ func NewAuthMiddleware(
 
 	return &AuthMiddleware{
 		publicKey:     publicKey,
+		sandboxes:     sandboxes,
 		logger:        logger,
 		revokedTokens: revokedTokens,
 	}
@@ -48,16 +59,24 @@ func NewAuthMiddleware(
 
 func (m *AuthMiddleware) JWTAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(response http.ResponseWriter, request *http.Request) {
-		claims, err := m.Check(request.Header.Get("Authorization"), request.URL.Path)
+		ctx, err := m.Authenticate(
+			request.Context(),
+			request.URL.Path,
+			request.Header.Get("Authorization"),
+			request.Header.Get(actAsHeader),
+		)
 		if err != nil {
 			response.Header().Set("Content-Type", "application/json")
 
 			m.logger.Errorf("can't check JWT: %s, payload: %s", err, m.payload(request))
 
 			var errRes error
-			if errors.Is(err, errForbidden) {
+			switch {
+			case errors.Is(err, errForbidden):
 				_, errRes = response.Write([]byte(`403 Forbidden\n`))
-			} else {
+			case errors.Is(err, models.ErrNotFound):
+				_, errRes = response.Write([]byte(`404 Not Found\n`))
+			default:
 				_, errRes = response.Write([]byte(`401 Unauthorized\n`))
 			}
 
@@ -68,8 +87,56 @@ func (m *AuthMiddleware) JWTAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		next.ServeHTTP(response, request.WithContext(ContextWithClaims(request.Context(), claims)))
+		next.ServeHTTP(response, request.WithContext(ctx))
+	}
+}
+
+// Authenticate checks the bearer token and the impersonated nickname, if any,
+// and returns ctx with the caller's claims. Used by JWTAuth and by connections
+// which pass the token in the first message.
+func (m *AuthMiddleware) Authenticate(ctx context.Context, path, authorization, actAs string) (context.Context, error) {
+	claims, err := m.Check(authorization, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkActAs(claims, actAs); err != nil {
+		return nil, err
+	}
+
+	ctx = ContextWithClaims(ctx, claims)
+
+	if actAs != "" {
+		m.logger.Infof("teacher %s acts as %s: %s", claims.Nickname, actAs, path)
+
+		ctx = context.WithValue(ctx, models.ContextActAsKey{}, actAs)
 	}
+
+	return ctx, nil
+}
+
+// checkActAs allows only teachers to work with someone else's sandbox, and only with an existing one,
+// so a typo in the nickname doesn't create an empty sandbox.
+func (m *AuthMiddleware) checkActAs(claims *models.AuthTokenClaims, actAs string) error {
+	if actAs == "" {
+		return nil
+	}
+
+	if !claims.IsTeacher {
+		return fmt.Errorf(
+			"%w: %s header is allowed only for teachers, nickname %s and id %s",
+			errForbidden,
+			actAsHeader,
+			claims.Nickname,
+			claims.ID,
+		)
+	}
+
+	if !m.sandboxes.HasSandbox(actAs) {
+		return fmt.Errorf("%w: sandbox with nickname %s", models.ErrNotFound, actAs)
+	}
+
+	return nil
 }
 
 func (m *AuthMiddleware) payload(request *http.Request) string {
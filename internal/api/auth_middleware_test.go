@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+
+	"seller-pages/internal/models"
+)
+
+// Auth failures keep the status 200 and report the error in the body, as clients expect.
+func (s *RouterSuite) TestAuthFailures() {
+	code, buf := s.do(http.MethodGet, "/api/products", "", nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal(`401 Unauthorized\n`, string(buf))
+
+	code, buf = s.do(http.MethodGet, "/api/products", "invalid", nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal(`401 Unauthorized\n`, string(buf))
+}
+
+func (s *RouterSuite) TestTeacherActsAsStudent() {
+	code, _ := s.do(http.MethodDelete, "/api/products/product-00", s.token(student, false), nil)
+	s.Require().Equal(http.StatusNoContent, code)
+
+	code, buf := s.do(http.MethodGet, "/api/products?pageSize=100", s.token(teacher, true), nil, actAsHeader, student)
+	s.Require().Equal(http.StatusOK, code, string(buf))
+	s.Len(decode[PaginatedResponse[models.ProductPreview]](s, buf).Data, seedProductsCount-1)
+
+	code, buf = s.do(http.MethodGet, "/api/products?pageSize=100", s.token(teacher, true), nil)
+	s.Require().Equal(http.StatusOK, code, string(buf))
+	s.Len(decode[PaginatedResponse[models.ProductPreview]](s, buf).Data, seedProductsCount, "teacher has an own sandbox")
+}
+
+func (s *RouterSuite) TestStudentCantActAs() {
+	code, _ := s.do(http.MethodGet, "/api/products", s.token(student, false), nil)
+	s.Require().Equal(http.StatusOK, code)
+
+	code, buf := s.do(http.MethodDelete, "/api/products/product-00", s.token("neighbour", false), nil, actAsHeader, student)
+	s.Equal(http.StatusOK, code)
+	s.Equal(`403 Forbidden\n`, string(buf))
+
+	code, buf = s.do(http.MethodGet, "/api/products?pageSize=100", s.token(student, false), nil)
+	s.Require().Equal(http.StatusOK, code)
+	s.Len(decode[PaginatedResponse[models.ProductPreview]](s, buf).Data, seedProductsCount)
+}
+
+func (s *RouterSuite) TestActAsUnknownNickname() {
+	code, buf := s.do(http.MethodGet, "/api/products", s.token(teacher, true), nil, actAsHeader, "nobody")
+	s.Equal(http.StatusOK, code)
+	s.Equal(`404 Not Found\n`, string(buf))
+
+	code, buf = s.do(http.MethodGet, "/api/sandboxes", s.token(teacher, true), nil)
+	s.Require().Equal(http.StatusOK, code)
+
+	for _, sandbox := range decode[[]models.SandboxInfo](s, buf) {
+		s.NotEqual("nobody", sandbox.Nickname, "unknown nickname must not create a sandbox")
+	}
+}
+
+func (s *RouterSuite) TestSandboxesListIsOnlyForTeachers() {
+	code, _ := s.do(http.MethodGet, "/api/products", s.token(student, false), nil)
+	s.Require().Equal(http.StatusOK, code)
+
+	code, _ = s.do(http.MethodGet, "/api/sandboxes", s.token(student, false), nil)
+	s.Equal(http.StatusForbidden, code)
+
+	code, buf := s.do(http.MethodGet, "/api/sandboxes", s.token(teacher, true), nil)
+	s.Require().Equal(http.StatusOK, code)
+
+	sandboxes := decode[[]models.SandboxInfo](s, buf)
+	s.Require().Len(sandboxes, 1, "listing must not create the teacher's sandbox")
+	s.Equal(student, sandboxes[0].Nickname)
+	s.Equal(seedProductsCount, sandboxes[0].ProductsCount)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	defaultEventsHeartbeat = 15 * time.Second
+	// eventsRetry is how long browsers wait before reconnecting, in milliseconds.
+	eventsRetry = 3000
+)
+
+var errStreamingUnsupported = errors.New("streaming is not supported")
+
+// tokenFromQuery lets browsers' EventSource, which can't send headers, pass the token as ?token=.
+func tokenFromQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if token := request.URL.Query().Get("token"); token != "" && request.Header.Get("Authorization") == "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		next.ServeHTTP(response, request)
+	}
+}
+
+// streamEvents sends changes of the caller's sandbox as Server-Sent Events until the client
+// disconnects or the server shuts down. Missed events are resent after Last-Event-ID.
+func (r *Router) streamEvents(writer http.ResponseWriter, request *http.Request) {
+	var lastEventID uint64
+
+	if header := request.Header.Get("Last-Event-ID"); header != "" {
+		var err error
+
+		lastEventID, err = strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			r.sendErrorResponse(writer, request, fmt.Errorf("%w: invalid Last-Event-ID: %w", models.ErrBadRequest, err))
+
+			return
+		}
+	}
+
+	controller := http.NewResponseController(writer)
+
+	// the stream lives longer than the server WriteTimeout allows for a response
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w: %w", models.ErrInternalServer, errStreamingUnsupported, err))
+
+		return
+	}
+
+	missed, events, cancel := r.eventsService.SubscribeEvents(request.Context(), lastEventID)
+	defer cancel()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	// disables response buffering in nginx
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(writer, "retry: %d\n\n", eventsRetry); err != nil {
+		return
+	}
+
+	for _, event := range missed {
+		if err := writeEvent(writer, event); err != nil {
+			return
+		}
+	}
+
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(r.heartbeat())
+	defer ticker.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-request.Context().Done():
+			return
+		case <-r.shutdown:
+			return
+		case event, ok := <-events:
+			if !ok {
+				// the client fell behind, it will reconnect and get the missed events
+				return
+			}
+
+			err = writeEvent(writer, event)
+		case <-ticker.C:
+			_, err = fmt.Fprint(writer, ": heartbeat\n\n")
+		}
+
+		if err == nil {
+			err = controller.Flush()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// heartbeat is the keep-alive interval of long-lived connections.
+func (r *Router) heartbeat() time.Duration {
+	if r.eventsHeartbeat <= 0 {
+		return defaultEventsHeartbeat
+	}
+
+	return r.eventsHeartbeat
+}
+
+func writeEvent(writer http.ResponseWriter, event models.Event) error {
+	_, err := fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+
+	return err
+}
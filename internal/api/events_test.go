@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"seller-pages/internal/config"
+	"seller-pages/internal/models"
+)
+
+// sseEvent is an event read from the events stream.
+type sseEvent struct {
+	ID   uint64
+	Type string
+}
+
+func (s *RouterSuite) TestEventsResumeAfterLastEventID() {
+	token := s.token(student, false)
+
+	for range 2 {
+		code, _ := s.do(http.MethodPost, "/api/products/generate", token, nil)
+		s.Require().Equal(http.StatusOK, code)
+	}
+
+	stream := s.openEvents(token, "1")
+
+	first := s.readEvent(stream)
+	s.Equal(uint64(2), first.ID, "events must be resent from the one after Last-Event-ID")
+
+	ids := []uint64{first.ID}
+	for range 2 {
+		ids = append(ids, s.readEvent(stream).ID)
+	}
+
+	s.Equal([]uint64{2, 3, 4}, ids)
+
+	stream = s.openEvents(token, "100")
+	s.Equal(models.EventResync, s.readEvent(stream).Type, "ids from the future mean the history is lost")
+
+	code, _ := s.do(http.MethodGet, "/api/events", token, nil, "Last-Event-ID", "invalid")
+	s.Equal(http.StatusBadRequest, code)
+}
+
+func (s *RouterSuite) TestEventsOutliveWriteTimeout() {
+	s.Require().NoError(s.router.Close())
+	s.serveWith(config.ServerOpts{
+		ReadTimeout:          10,
+		WriteTimeout:         1,
+		IdleTimeout:          10,
+		MaxRequestBodySizeMb: 1,
+		EventsHeartbeat:      1,
+	}, s.products)
+
+	token := s.token(student, false)
+	stream := s.openEvents(token, "")
+
+	time.Sleep(1500 * time.Millisecond)
+
+	code, _ := s.do(http.MethodPost, "/api/products/generate", token, nil)
+	s.Require().Equal(http.StatusOK, code)
+
+	s.Equal(models.EventProductCreated, s.readEvent(stream).Type, "the stream must not be cut by the write timeout")
+}
+
+// openEvents subscribes to the events stream, it's closed at the end of the test.
+func (s *RouterSuite) openEvents(token, lastEventID string) *bufio.Reader {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	s.T().Cleanup(cancel)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/api/events?token="+token, nil)
+	s.Require().NoError(err)
+
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+
+	s.T().Cleanup(func() {
+		_ = response.Body.Close()
+	})
+
+	return bufio.NewReader(response.Body)
+}
+
+// readEvent skips comments and retry lines and returns the next event of the stream.
+func (s *RouterSuite) readEvent(stream *bufio.Reader) sseEvent {
+	var event sseEvent
+
+	for {
+		line, err := stream.ReadString('\n')
+		s.Require().NoError(err)
+
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && event.Type != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.ID, err = strconv.ParseUint(strings.TrimPrefix(line, "id: "), 10, 64)
+			s.Require().NoError(err)
+		case strings.HasPrefix(line, "event: "):
+			event.Type = strings.TrimPrefix(line, "event: ")
+		}
+	}
+}
@@ -1,11 +1,18 @@
 package api
 
 type PaginatedResponse[T any] struct {
-	Page       int `json:"currentPage"`
-	TotalPages int `json:"totalPages"`
+	Page       int    `json:"currentPage,omitempty"`
+	TotalPages int    `json:"totalPages"`
+	PageSize   int    `json:"pageSize"`
+	NextCursor string `json:"nextCursor,omitempty"`
 	Data       []T
 }
 
 type TokenResponse struct {
 	Token string `json:"token"`
 }
+
+type ValidationErrorResponse struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields"`
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"seller-pages/internal/models"
+)
+
+func (s *RouterSuite) TestUpdateProduct() {
+	token := s.token(student, false)
+	created := s.createProduct(token)
+
+	code, buf := s.do(http.MethodPut, "/api/products/"+created.ID, token, `{
+		"name": "Ноутбук Pro",
+		"article": "1234567890",
+		"category": "Электроника",
+		"price": 150,
+		"warehouseQuantity": 10,
+		"id": "other",
+		"rating": 5,
+		"createdAt": "2000-01-01T00:00:00Z"
+	}`)
+	s.Require().Equal(http.StatusOK, code, string(buf))
+
+	updated := decode[models.ProductPageInfo](s, buf)
+	s.Equal(created.ID, updated.ID, "read-only fields must be ignored")
+	s.Equal(created.CreatedAt, updated.CreatedAt)
+	s.Zero(updated.Rating)
+	s.Equal("Ноутбук Pro", updated.Name)
+	s.Zero(updated.OldPrice, "fields missing in PUT must be reset")
+	s.Empty(updated.Description)
+	s.Equal(3, updated.WarehouseQuantity, "the stock is changed only through the stock endpoint")
+
+	code, buf = s.do(http.MethodPut, "/api/products/"+created.ID, token, models.ProductInput{
+		Name:     "Ноутбук",
+		Article:  "123",
+		Category: testCategory,
+	})
+	s.Require().Equal(http.StatusBadRequest, code)
+
+	validationErr := decode[ValidationErrorResponse](s, buf)
+	s.Contains(validationErr.Fields, "article")
+	s.Contains(validationErr.Fields, "price")
+
+	code, _ = s.do(http.MethodPut, "/api/products/unknown", token, models.ProductInput{})
+	s.Equal(http.StatusNotFound, code)
+}
+
+func (s *RouterSuite) TestPatchProduct() {
+	token := s.token(student, false)
+	created := s.createProduct(token)
+	path := "/api/products/" + created.ID
+
+	code, buf := s.do(http.MethodPatch, path, token, `{"price": 170}`, "Content-Type", "application/merge-patch+json")
+	s.Require().Equal(http.StatusOK, code, string(buf))
+
+	patched := decode[models.ProductPageInfo](s, buf)
+	s.InDelta(170, patched.Price, 0.001)
+	s.InDelta(180, patched.OldPrice, 0.001, "fields missing in the patch must be kept")
+	s.Equal("Игровой", patched.Description)
+	s.Equal(3, patched.WarehouseQuantity)
+
+	code, buf = s.do(http.MethodPatch, path, token, `{"oldPrice": null, "description": null}`)
+	s.Require().Equal(http.StatusOK, code, string(buf))
+
+	patched = decode[models.ProductPageInfo](s, buf)
+	s.Zero(patched.OldPrice, "null must remove the value")
+	s.Empty(patched.Description)
+	s.InDelta(170, patched.Price, 0.001)
+
+	code, buf = s.do(http.MethodPatch, path, token, `{"name": null}`)
+	s.Require().Equal(http.StatusBadRequest, code)
+	s.Contains(decode[ValidationErrorResponse](s, buf).Fields, "name", "patched product must be valid")
+
+	code, buf = s.do(http.MethodPatch, path, token, `{"id": "other", "rating": 5, "nmae": "Ноутбук", "warehouseQuantity": 10}`)
+	s.Require().Equal(http.StatusBadRequest, code)
+	s.Equal(
+		map[string]string{
+			"id":                "unknown or read-only field",
+			"rating":            "unknown or read-only field",
+			"nmae":              "unknown or read-only field",
+			"warehouseQuantity": "unknown or read-only field",
+		},
+		decode[ValidationErrorResponse](s, buf).Fields,
+	)
+
+	for _, body := range []string{`null`, `[]`, `{"price": "free"}`} {
+		code, _ = s.do(http.MethodPatch, path, token, body)
+		s.Equal(http.StatusBadRequest, code, body)
+	}
+
+	code, buf = s.do(http.MethodGet, path, token, nil)
+	s.Require().Equal(http.StatusOK, code)
+	s.Equal(patched, decode[models.ProductPageInfo](s, buf), "rejected patches must not change the product")
+
+	code, _ = s.do(http.MethodPatch, "/api/products/unknown", token, `{"price": 1}`)
+	s.Equal(http.StatusNotFound, code)
+}
+
+// createProduct adds a valid editable product to the sandbox of the token owner.
+func (s *RouterSuite) createProduct(token string) models.ProductPageInfo {
+	code, buf := s.do(http.MethodPost, "/api/products", token, models.NewProductInput{
+		ProductInput: models.ProductInput{
+			Name:        "Ноутбук",
+			Article:     "1234567890",
+			Category:    testCategory,
+			Description: "Игровой",
+			OldPrice:    180,
+			Price:       150,
+		},
+		WarehouseQuantity: 3,
+	})
+	s.Require().Equal(http.StatusCreated, code, string(buf))
+
+	return decode[models.ProductPageInfo](s, buf)
+}
+
+func (s *RouterSuite) TestProductsSearchFilterAndSort() {
+	token := s.token(student, false)
+	created := s.createProduct(token)
+
+	list := func(query string) []string {
+		code, buf := s.do(http.MethodGet, "/api/products?"+query, token, nil)
+		s.Require().Equal(http.StatusOK, code, string(buf))
+
+		page := decode[PaginatedResponse[models.ProductPreview]](s, buf)
+
+		ids := make([]string, len(page.Data))
+		for i, product := range page.Data {
+			ids[i] = product.ID
+		}
+
+		return ids
+	}
+
+	s.Equal(
+		[]string{"product-06", "product-05", "product-04", "product-03"},
+		list("search=PRODUCT&minPrice=103&maxPrice=106&sort=price&order=desc"),
+	)
+	s.Equal([]string{"product-05"}, list("minPrice=105&maxPrice=105"), "price bounds are inclusive")
+	s.Equal([]string{created.ID}, list("search="+url.QueryEscape("игровой ноутбук")+"&hasDiscount=true"))
+	s.Equal([]string{created.ID}, list("category="+url.QueryEscape(testCategory)+"&minPrice=150&removable=true&sort=price"))
+	s.Equal([]string{"product-08", "product-09", created.ID}, list("minPrice=108&sort=price"))
+	s.Empty(list("search=product&hasDiscount=true"))
+	s.Empty(list("category=unknown"))
+
+	for _, query := range []string{
+		"minPrice=200&maxPrice=100",
+		"minPrice=abc",
+		"maxPrice=NaN",
+		"minPrice=-Inf",
+		"sort=unknown",
+		"sort=price&order=up",
+	} {
+		code, _ := s.do(http.MethodGet, "/api/products?"+query, token, nil)
+		s.Equal(http.StatusBadRequest, code, query)
+	}
+}
+
+func (s *RouterSuite) TestProductsPeriod() {
+	token := s.token(student, false)
+
+	list := func(since, until string) (int, []models.ProductPreview) {
+		query := url.Values{"since": {since}, "until": {until}}
+
+		code, buf := s.do(http.MethodGet, "/api/products?"+query.Encode(), token, nil)
+		if code != http.StatusOK {
+			return code, nil
+		}
+
+		return code, decode[PaginatedResponse[models.ProductPreview]](s, buf).Data
+	}
+
+	code, products := list("2000-01-01T00:00:00Z", "2000-01-01T00:00:00Z")
+	s.Equal(http.StatusOK, code, "equal bounds must be accepted")
+	s.Empty(products, "until is exclusive")
+
+	code, _ = list("2000-01-02T00:00:00Z", "2000-01-01T00:00:00Z")
+	s.Equal(http.StatusBadRequest, code)
+}
@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"seller-pages/internal/config"
@@ -18,20 +22,101 @@ import (
 
 var (
 	errInvalidPageNumber = errors.New("invalid page number")
+	errInvalidPageSize   = errors.New("invalid page size")
 	errEmptyID           = errors.New("empty id")
 	errEmptyName         = errors.New("empty name")
+	errInvalidBody       = errors.New("invalid request body")
+	errInvalidParameter  = errors.New("invalid query parameter")
 )
 
 type ProductsService interface {
-	GetProductsList(ctx context.Context, page int) ([]models.ProductPreview, int)
+	GetProductsList(
+		ctx context.Context,
+		pageRequest models.PageRequest,
+		filter models.ProductFilter,
+	) ([]models.ProductPreview, models.Pagination, error)
 	GetProductByID(ctx context.Context, id string) (models.ProductPageInfo, error)
 	AddProduct(ctx context.Context) models.ProductPreview
+	CreateProduct(ctx context.Context, input models.NewProductInput) (models.ProductPreview, error)
+	UpdateProduct(ctx context.Context, productID string, input models.ProductInput) (models.ProductPageInfo, error)
+	PatchProduct(ctx context.Context, productID string, patch map[string]any) (models.ProductPageInfo, error)
 	DeleteProductByID(ctx context.Context, productID string) error
-	GetProductsWithFeedbacks(ctx context.Context, page int) ([]models.FeedbackPageInfo, int)
+	GetProductsWithFeedbacks(
+		ctx context.Context,
+		pageRequest models.PageRequest,
+		filter models.FeedbackFilter,
+	) ([]models.FeedbackPageInfo, models.Pagination, error)
+	GetCategories(ctx context.Context) []models.CategoryInfo
+	AdjustStock(ctx context.Context, productID string, input models.StockAdjustmentInput) (models.StockMovement, error)
+	GetStockMovements(
+		ctx context.Context,
+		productID string,
+		pageRequest models.PageRequest,
+		filter models.StockMovementFilter,
+	) ([]models.StockMovement, models.Pagination, error)
+	SetLowStockThreshold(
+		ctx context.Context,
+		productID string,
+		input models.LowStockThresholdInput,
+	) (models.ProductPageInfo, error)
+	GetLowStockProducts(ctx context.Context) []models.ProductPageInfo
+}
+
+type FeedbacksService interface {
+	GetProductFeedbacks(
+		ctx context.Context,
+		productID string,
+		pageRequest models.PageRequest,
+		filter models.FeedbackFilter,
+	) ([]*models.Feedback, models.Pagination, error)
+	GetFeedbackStats(ctx context.Context, productID string) (models.FeedbackStats, error)
+	GetShopFeedbackStats(ctx context.Context) models.FeedbackStats
+	MarkFeedbacksRead(ctx context.Context, input models.MarkReadInput) (models.FeedbackCounters, error)
+	GetFeedbackCounters(ctx context.Context) models.FeedbackCounters
+	GetFeedbackSimulator(ctx context.Context) models.SimulatorSettings
+	SetFeedbackSimulator(ctx context.Context, settings models.SimulatorSettings) (models.SimulatorSettings, error)
+	AddFeedbackReply(ctx context.Context, feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error)
+	UpdateFeedbackReply(ctx context.Context, feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error)
+	DeleteFeedbackReply(ctx context.Context, feedbackID string) error
+}
+
+type OrdersService interface {
+	GetOrders(
+		ctx context.Context,
+		pageRequest models.PageRequest,
+		filter models.OrderFilter,
+	) ([]models.Order, models.Pagination, error)
+	GetOrderByID(ctx context.Context, orderID string) (models.Order, error)
+	ChangeOrderStatus(ctx context.Context, orderID string, input models.OrderStatusInput) (models.Order, error)
+	AddRandomOrder(ctx context.Context) (models.Order, error)
+	GetOrderSimulator(ctx context.Context) models.SimulatorSettings
+	SetOrderSimulator(ctx context.Context, settings models.SimulatorSettings) (models.SimulatorSettings, error)
+}
+
+type RefundsService interface {
+	GetRefunds(
+		ctx context.Context,
+		pageRequest models.PageRequest,
+		filter models.RefundFilter,
+	) ([]models.Refund, models.Pagination, error)
+	GetRefundByID(ctx context.Context, refundID string) (models.Refund, error)
+	RequestRefund(ctx context.Context, input models.RefundInput) (models.Refund, error)
+	ResolveRefund(ctx context.Context, refundID string, input models.RefundResolutionInput) (models.Refund, error)
+}
+
+type SandboxService interface {
+	ResetSandbox(ctx context.Context)
+	GetSandboxSnapshot(ctx context.Context) models.SandboxSnapshot
+	RestoreSandbox(ctx context.Context, snapshot models.SandboxSnapshot) error
+	ListSandboxes(ctx context.Context) ([]models.SandboxInfo, error)
+}
+
+type EventsService interface {
+	SubscribeEvents(ctx context.Context, lastEventID uint64) (missed []models.Event, events <-chan models.Event, cancel func())
 }
 
 type BalanceService interface {
-	GetBalanceInfo() models.BalanceInfo
+	GetBalanceInfo(ctx context.Context, query models.ChartQuery) (models.BalanceInfo, error)
 }
 
 type TokenService interface {
@@ -42,9 +127,21 @@ type Router struct {
 	*http.Server
 	router *http.ServeMux
 
-	productsService ProductsService
-	balanceService  BalanceService
-	tokenService    TokenService
+	productsService  ProductsService
+	feedbacksService FeedbacksService
+	ordersService    OrdersService
+	refundsService   RefundsService
+	sandboxService   SandboxService
+	eventsService    EventsService
+	balanceService   BalanceService
+	tokenService     TokenService
+
+	maxRequestBodySize int64
+	eventsHeartbeat    time.Duration
+	// shutdown is closed when the server starts shutting down, so event streams don't hold it.
+	shutdown     chan struct{}
+	connections  connTracker
+	authenticate func(ctx context.Context, path, authorization, actAs string) (context.Context, error)
 
 	logger *zap.SugaredLogger
 }
@@ -52,9 +149,15 @@ type Router struct {
 func NewRouter(
 	cfg config.ServerOpts,
 	productsService ProductsService,
+	feedbacksService FeedbacksService,
+	ordersService OrdersService,
+	refundsService RefundsService,
+	sandboxService SandboxService,
+	eventsService EventsService,
 	balanceService BalanceService,
 	tokenService TokenService,
 	authMiddleware func(next http.HandlerFunc) http.HandlerFunc,
+	authenticate func(ctx context.Context, path, authorization, actAs string) (context.Context, error),
 	logger *zap.SugaredLogger,
 ) *Router {
 	innerRouter := http.NewServeMux()
@@ -66,24 +169,78 @@ func NewRouter(
 			WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Second,
 			IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Second,
 		},
-		router:          innerRouter,
-		productsService: productsService,
-		balanceService:  balanceService,
-		tokenService:    tokenService,
-		logger:          logger,
+		router:           innerRouter,
+		productsService:  productsService,
+		feedbacksService: feedbacksService,
+		ordersService:    ordersService,
+		refundsService:   refundsService,
+		sandboxService:   sandboxService,
+		eventsService:    eventsService,
+		balanceService:   balanceService,
+		tokenService:     tokenService,
+		logger:           logger,
+
+		maxRequestBodySize: int64(cfg.MaxRequestBodySizeMb) << 20,
+		eventsHeartbeat:    time.Duration(cfg.EventsHeartbeat) * time.Second,
+		shutdown:           make(chan struct{}),
+		authenticate:       authenticate,
 	}
 
+	appRouter.RegisterOnShutdown(func() {
+		close(appRouter.shutdown)
+	})
+
 	innerRouter.HandleFunc("POST /api/products/generate", authMiddleware(appRouter.addProduct))
+	innerRouter.HandleFunc("POST /api/products", authMiddleware(appRouter.createProduct))
 	innerRouter.HandleFunc("GET /api/products", authMiddleware(appRouter.getProductsList))
+	innerRouter.HandleFunc("GET /api/products/low-stock", authMiddleware(appRouter.getLowStockProducts))
 
 	innerRouter.HandleFunc("GET /api/products/{id}", authMiddleware(appRouter.getProductByID))
+	innerRouter.HandleFunc("PUT /api/products/{id}", authMiddleware(appRouter.updateProduct))
+	innerRouter.HandleFunc("PATCH /api/products/{id}", authMiddleware(appRouter.patchProduct))
 	innerRouter.HandleFunc("DELETE /api/products/{id}", authMiddleware(appRouter.deleteProductByID))
+	innerRouter.HandleFunc("GET /api/products/{id}/feedbacks", authMiddleware(appRouter.getProductFeedbacks))
+	innerRouter.HandleFunc("GET /api/products/{id}/feedbacks/stats", authMiddleware(appRouter.getFeedbackStats))
+	innerRouter.HandleFunc("POST /api/products/{id}/stock", authMiddleware(appRouter.adjustStock))
+	innerRouter.HandleFunc("GET /api/products/{id}/stock/movements", authMiddleware(appRouter.getStockMovements))
+	innerRouter.HandleFunc("PUT /api/products/{id}/stock/threshold", authMiddleware(appRouter.setLowStockThreshold))
+
+	innerRouter.HandleFunc("GET /api/categories", authMiddleware(appRouter.getCategories))
+
+	innerRouter.HandleFunc("POST /api/orders/generate", authMiddleware(appRouter.addOrder))
+	innerRouter.HandleFunc("GET /api/orders/simulator", authMiddleware(appRouter.getOrderSimulator))
+	innerRouter.HandleFunc("PUT /api/orders/simulator", authMiddleware(appRouter.setOrderSimulator))
+	innerRouter.HandleFunc("GET /api/orders", authMiddleware(appRouter.getOrders))
+	innerRouter.HandleFunc("GET /api/orders/{id}", authMiddleware(appRouter.getOrderByID))
+	innerRouter.HandleFunc("POST /api/orders/{id}/status", authMiddleware(appRouter.changeOrderStatus))
+
+	innerRouter.HandleFunc("GET /api/refunds", authMiddleware(appRouter.getRefunds))
+	innerRouter.HandleFunc("GET /api/refunds/pending", authMiddleware(appRouter.getPendingRefunds))
+	innerRouter.HandleFunc("POST /api/refunds", authMiddleware(appRouter.requestRefund))
+	innerRouter.HandleFunc("GET /api/refunds/{id}", authMiddleware(appRouter.getRefundByID))
+	innerRouter.HandleFunc("POST /api/refunds/{id}/resolve", authMiddleware(appRouter.resolveRefund))
+
+	innerRouter.HandleFunc("POST /api/sandbox/reset", authMiddleware(appRouter.resetSandbox))
+	innerRouter.HandleFunc("GET /api/sandbox/snapshot", authMiddleware(appRouter.getSandboxSnapshot))
+	innerRouter.HandleFunc("POST /api/sandbox/restore", authMiddleware(appRouter.restoreSandbox))
+	innerRouter.HandleFunc("GET /api/sandboxes", authMiddleware(appRouter.listSandboxes))
+
+	innerRouter.HandleFunc("GET /api/events", tokenFromQuery(authMiddleware(appRouter.streamEvents)))
+	innerRouter.HandleFunc("GET /api/ws", appRouter.serveWebSocket)
 
 	innerRouter.HandleFunc("GET /api/balanceInfo", authMiddleware(appRouter.getBalanceInfo))
 
 	innerRouter.HandleFunc("POST /api/createToken", authMiddleware(appRouter.createToken))
 	innerRouter.HandleFunc("POST /api/createTeacherToken", authMiddleware(appRouter.createTeacherToken))
 	innerRouter.HandleFunc("GET /api/feedbacks", authMiddleware(appRouter.getFeedbacks))
+	innerRouter.HandleFunc("GET /api/feedbacks/stats", authMiddleware(appRouter.getShopFeedbackStats))
+	innerRouter.HandleFunc("GET /api/feedbacks/unread-count", authMiddleware(appRouter.getFeedbackCounters))
+	innerRouter.HandleFunc("POST /api/feedbacks/read", authMiddleware(appRouter.markFeedbacksRead))
+	innerRouter.HandleFunc("GET /api/feedbacks/simulator", authMiddleware(appRouter.getFeedbackSimulator))
+	innerRouter.HandleFunc("PUT /api/feedbacks/simulator", authMiddleware(appRouter.setFeedbackSimulator))
+	innerRouter.HandleFunc("POST /api/feedbacks/{id}/reply", authMiddleware(appRouter.addFeedbackReply))
+	innerRouter.HandleFunc("PUT /api/feedbacks/{id}/reply", authMiddleware(appRouter.updateFeedbackReply))
+	innerRouter.HandleFunc("DELETE /api/feedbacks/{id}/reply", authMiddleware(appRouter.deleteFeedbackReply))
 	innerRouter.HandleFunc("GET /", func(writer http.ResponseWriter, request *http.Request) {
 		http.ServeFile(writer, request, "redoc-static.html")
 	})
@@ -104,7 +261,29 @@ func (r *Router) sendResponse(response http.ResponseWriter, request *http.Reques
 }
 
 func (r *Router) sendErrorResponse(response http.ResponseWriter, request *http.Request, err error) {
+	var validationErr *models.ValidationError
+
 	switch {
+	case errors.As(err, &validationErr):
+		r.logger.With(
+			"module", "api",
+			"request_url", request.Method+": "+request.URL.Path,
+		).Warn(err)
+
+		buf, marshalErr := json.Marshal(ValidationErrorResponse{
+			Error:  validationErr.Error(),
+			Fields: validationErr.Fields,
+		})
+		if marshalErr != nil {
+			response.WriteHeader(http.StatusBadRequest)
+			r.writeError(response, request, err)
+
+			return
+		}
+
+		r.sendResponse(response, request, http.StatusBadRequest, buf)
+
+		return
 	case errors.Is(err, models.ErrBadRequest):
 		response.WriteHeader(http.StatusBadRequest)
 		r.logger.With(
@@ -133,6 +312,16 @@ func (r *Router) sendErrorResponse(response http.ResponseWriter, request *http.R
 
 		r.writeError(response, request, err)
 
+		return
+	case errors.Is(err, models.ErrConflict):
+		response.WriteHeader(http.StatusConflict)
+		r.logger.With(
+			"module", "api",
+			"request_url", request.Method+": "+request.URL.Path,
+		).Warn(err)
+
+		r.writeError(response, request, err)
+
 		return
 	case errors.Is(err, models.ErrUnauthorized):
 		response.WriteHeader(http.StatusUnauthorized)
@@ -166,19 +355,33 @@ func (r *Router) writeError(response http.ResponseWriter, request *http.Request,
 }
 
 func (r *Router) getProductsList(writer http.ResponseWriter, request *http.Request) {
-	page, err := getPage(request)
+	pageRequest, err := getPageRequest(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	filter, err := getProductFilter(request)
 	if err != nil {
 		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
 
 		return
 	}
 
-	result, totalPages := r.productsService.GetProductsList(request.Context(), page)
+	result, pagination, err := r.productsService.GetProductsList(request.Context(), pageRequest, filter)
+	if err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
 
 	responseBody := PaginatedResponse[models.ProductPreview]{
-		TotalPages: totalPages,
+		TotalPages: pagination.TotalPages,
+		PageSize:   pageRequest.PageSize,
+		NextCursor: pagination.NextCursor,
 		Data:       result,
-		Page:       page,
+		Page:       pageRequest.Page,
 	}
 
 	buf, err := json.Marshal(responseBody)
@@ -217,7 +420,19 @@ func (r *Router) getProductByID(writer http.ResponseWriter, request *http.Reques
 }
 
 func (r *Router) getBalanceInfo(writer http.ResponseWriter, request *http.Request) {
-	responseBody := r.balanceService.GetBalanceInfo()
+	query, err := getChartQuery(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	responseBody, err := r.balanceService.GetBalanceInfo(request.Context(), query)
+	if err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
 
 	buf, err := json.Marshal(responseBody)
 	if err != nil {
@@ -230,8 +445,35 @@ func (r *Router) getBalanceInfo(writer http.ResponseWriter, request *http.Reques
 
 }
 
-func (r *Router) addProduct(writer http.ResponseWriter, request *http.Request) {
-	responseBody := r.productsService.AddProduct(request.Context())
+func (r *Router) getOrders(writer http.ResponseWriter, request *http.Request) {
+	pageRequest, err := getPageRequest(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	filter, err := getOrderFilter(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	result, pagination, err := r.ordersService.GetOrders(request.Context(), pageRequest, filter)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("GetOrders: %w", err))
+
+		return
+	}
+
+	responseBody := PaginatedResponse[models.Order]{
+		TotalPages: pagination.TotalPages,
+		PageSize:   pageRequest.PageSize,
+		NextCursor: pagination.NextCursor,
+		Data:       result,
+		Page:       pageRequest.Page,
+	}
 
 	buf, err := json.Marshal(responseBody)
 	if err != nil {
@@ -243,7 +485,7 @@ func (r *Router) addProduct(writer http.ResponseWriter, request *http.Request) {
 	r.sendResponse(writer, request, http.StatusOK, buf)
 }
 
-func (r *Router) deleteProductByID(writer http.ResponseWriter, request *http.Request) {
+func (r *Router) getOrderByID(writer http.ResponseWriter, request *http.Request) {
 	id := request.PathValue("id")
 	if id == "" {
 		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
@@ -251,51 +493,99 @@ func (r *Router) deleteProductByID(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
-	err := r.productsService.DeleteProductByID(request.Context(), id)
+	order, err := r.ordersService.GetOrderByID(request.Context(), id)
 	if err != nil {
-		r.sendErrorResponse(writer, request, fmt.Errorf("GetProductByID: %w", err))
+		r.sendErrorResponse(writer, request, fmt.Errorf("GetOrderByID: %w", err))
 
 		return
 	}
 
-	writer.WriteHeader(http.StatusNoContent)
+	buf, err := json.Marshal(order)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
 }
 
-func (r *Router) createToken(writer http.ResponseWriter, request *http.Request) {
-	name := request.URL.Query().Get("name")
-	if name == "" {
-		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyName))
+func (r *Router) changeOrderStatus(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
 
 		return
 	}
 
-	token, err := r.tokenService.GenerateToken(request.Context(), name, false)
+	var input models.OrderStatusInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	order, err := r.ordersService.ChangeOrderStatus(request.Context(), id, input)
 	if err != nil {
-		r.sendErrorResponse(writer, request, fmt.Errorf("CreateToken: %w", err))
+		r.sendErrorResponse(writer, request, fmt.Errorf("ChangeOrderStatus: %w", err))
 
 		return
 	}
 
-	r.sendResponse(writer, request, http.StatusOK, []byte(token))
+	buf, err := json.Marshal(order)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
 }
 
-func (r *Router) createTeacherToken(writer http.ResponseWriter, request *http.Request) {
-	name := request.URL.Query().Get("name")
-	if name == "" {
-		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyName))
+func (r *Router) addOrder(writer http.ResponseWriter, request *http.Request) {
+	order, err := r.ordersService.AddRandomOrder(request.Context())
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("AddRandomOrder: %w", err))
 
 		return
 	}
 
-	token, err := r.tokenService.GenerateToken(request.Context(), name, true)
+	buf, err := json.Marshal(order)
 	if err != nil {
-		r.sendErrorResponse(writer, request, fmt.Errorf("CreateToken: %w", err))
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
 
 		return
 	}
 
-	responseBody := TokenResponse{
-		Token: token,
+	r.sendResponse(writer, request, http.StatusCreated, buf)
+}
+
+func (r *Router) getOrderSimulator(writer http.ResponseWriter, request *http.Request) {
+	responseBody := r.ordersService.GetOrderSimulator(request.Context())
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) setOrderSimulator(writer http.ResponseWriter, request *http.Request) {
+	var settings models.SimulatorSettings
+	if err := r.decodeBody(writer, request, &settings); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	responseBody, err := r.ordersService.SetOrderSimulator(request.Context(), settings)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("SetOrderSimulator: %w", err))
+
+		return
 	}
 
 	buf, err := json.Marshal(responseBody)
@@ -308,20 +598,52 @@ func (r *Router) createTeacherToken(writer http.ResponseWriter, request *http.Re
 	r.sendResponse(writer, request, http.StatusOK, buf)
 }
 
-func (r *Router) getFeedbacks(writer http.ResponseWriter, request *http.Request) {
-	page, err := getPage(request)
+func (r *Router) getRefunds(writer http.ResponseWriter, request *http.Request) {
+	filter, err := getRefundFilter(request)
 	if err != nil {
 		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
 
 		return
 	}
 
-	result, totalPages := r.productsService.GetProductsWithFeedbacks(request.Context(), page)
+	r.sendRefunds(writer, request, filter)
+}
 
-	responseBody := PaginatedResponse[models.FeedbackPageInfo]{
-		TotalPages: totalPages,
+// getPendingRefunds lists refunds waiting for the seller decision, other status filters are ignored.
+func (r *Router) getPendingRefunds(writer http.ResponseWriter, request *http.Request) {
+	filter, err := getRefundFilter(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	filter.Statuses = []string{models.RefundStatusPending}
+
+	r.sendRefunds(writer, request, filter)
+}
+
+func (r *Router) sendRefunds(writer http.ResponseWriter, request *http.Request, filter models.RefundFilter) {
+	pageRequest, err := getPageRequest(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	result, pagination, err := r.refundsService.GetRefunds(request.Context(), pageRequest, filter)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("GetRefunds: %w", err))
+
+		return
+	}
+
+	responseBody := PaginatedResponse[models.Refund]{
+		TotalPages: pagination.TotalPages,
+		PageSize:   pageRequest.PageSize,
+		NextCursor: pagination.NextCursor,
 		Data:       result,
-		Page:       page,
+		Page:       pageRequest.Page,
 	}
 
 	buf, err := json.Marshal(responseBody)
@@ -334,21 +656,1080 @@ func (r *Router) getFeedbacks(writer http.ResponseWriter, request *http.Request)
 	r.sendResponse(writer, request, http.StatusOK, buf)
 }
 
-func getPage(request *http.Request) (int, error) {
-	pageParameter := request.URL.Query().Get("page")
+func (r *Router) getRefundByID(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	refund, err := r.refundsService.GetRefundByID(request.Context(), id)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("GetRefundByID: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(refund)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) requestRefund(writer http.ResponseWriter, request *http.Request) {
+	var input models.RefundInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	refund, err := r.refundsService.RequestRefund(request.Context(), input)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("RequestRefund: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(refund)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusCreated, buf)
+}
+
+func (r *Router) resolveRefund(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	var input models.RefundResolutionInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	refund, err := r.refundsService.ResolveRefund(request.Context(), id, input)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("ResolveRefund: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(refund)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) adjustStock(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	var input models.StockAdjustmentInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	movement, err := r.productsService.AdjustStock(request.Context(), id, input)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("AdjustStock: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(movement)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusCreated, buf)
+}
+
+func (r *Router) getStockMovements(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	pageRequest, err := getPageRequest(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
 
-	if pageParameter == "" {
-		return 1, nil
+		return
 	}
 
-	page, err := strconv.Atoi(pageParameter)
+	filter, err := getStockMovementFilter(request)
 	if err != nil {
-		return 0, fmt.Errorf("%w: %w", errInvalidPageNumber, err)
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
 	}
 
-	if page <= 0 {
-		return 0, fmt.Errorf("%w: %d", errInvalidPageNumber, page)
+	result, pagination, err := r.productsService.GetStockMovements(request.Context(), id, pageRequest, filter)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("GetStockMovements: %w", err))
+
+		return
+	}
+
+	responseBody := PaginatedResponse[models.StockMovement]{
+		TotalPages: pagination.TotalPages,
+		PageSize:   pageRequest.PageSize,
+		NextCursor: pagination.NextCursor,
+		Data:       result,
+		Page:       pageRequest.Page,
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) setLowStockThreshold(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	var input models.LowStockThresholdInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	product, err := r.productsService.SetLowStockThreshold(request.Context(), id, input)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("SetLowStockThreshold: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(product)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) getLowStockProducts(writer http.ResponseWriter, request *http.Request) {
+	responseBody := r.productsService.GetLowStockProducts(request.Context())
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) getCategories(writer http.ResponseWriter, request *http.Request) {
+	responseBody := r.productsService.GetCategories(request.Context())
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) addProduct(writer http.ResponseWriter, request *http.Request) {
+	responseBody := r.productsService.AddProduct(request.Context())
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) createProduct(writer http.ResponseWriter, request *http.Request) {
+	var input models.NewProductInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	responseBody, err := r.productsService.CreateProduct(request.Context(), input)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("CreateProduct: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusCreated, buf)
+}
+
+func (r *Router) updateProduct(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	var input models.ProductInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	product, err := r.productsService.UpdateProduct(request.Context(), id, input)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("UpdateProduct: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(product)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) patchProduct(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	var patch map[string]any
+	if err := r.decodeBody(writer, request, &patch); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	if patch == nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w: patch must be an object", models.ErrBadRequest, errInvalidBody))
+
+		return
+	}
+
+	product, err := r.productsService.PatchProduct(request.Context(), id, patch)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("PatchProduct: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(product)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) deleteProductByID(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	err := r.productsService.DeleteProductByID(request.Context(), id)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("GetProductByID: %w", err))
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Router) resetSandbox(writer http.ResponseWriter, request *http.Request) {
+	r.sandboxService.ResetSandbox(request.Context())
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Router) getSandboxSnapshot(writer http.ResponseWriter, request *http.Request) {
+	responseBody := r.sandboxService.GetSandboxSnapshot(request.Context())
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) restoreSandbox(writer http.ResponseWriter, request *http.Request) {
+	var snapshot models.SandboxSnapshot
+	if err := r.decodeBody(writer, request, &snapshot); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	if err := r.sandboxService.RestoreSandbox(request.Context(), snapshot); err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("RestoreSandbox: %w", err))
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Router) listSandboxes(writer http.ResponseWriter, request *http.Request) {
+	responseBody, err := r.sandboxService.ListSandboxes(request.Context())
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("ListSandboxes: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) createToken(writer http.ResponseWriter, request *http.Request) {
+	name := request.URL.Query().Get("name")
+	if name == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyName))
+
+		return
+	}
+
+	token, err := r.tokenService.GenerateToken(request.Context(), name, false)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("CreateToken: %w", err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, []byte(token))
+}
+
+func (r *Router) createTeacherToken(writer http.ResponseWriter, request *http.Request) {
+	name := request.URL.Query().Get("name")
+	if name == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyName))
+
+		return
+	}
+
+	token, err := r.tokenService.GenerateToken(request.Context(), name, true)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("CreateToken: %w", err))
+
+		return
+	}
+
+	responseBody := TokenResponse{
+		Token: token,
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) getFeedbacks(writer http.ResponseWriter, request *http.Request) {
+	pageRequest, err := getPageRequest(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	var filter models.FeedbackFilter
+
+	filter.Since, filter.Until, err = getPeriod(request.URL.Query())
+	if err == nil {
+		filter.Unread, err = getOptionalBool(request.URL.Query(), "unread")
+	}
+
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	result, pagination, err := r.productsService.GetProductsWithFeedbacks(request.Context(), pageRequest, filter)
+	if err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	responseBody := PaginatedResponse[models.FeedbackPageInfo]{
+		TotalPages: pagination.TotalPages,
+		PageSize:   pageRequest.PageSize,
+		NextCursor: pagination.NextCursor,
+		Data:       result,
+		Page:       pageRequest.Page,
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) getProductFeedbacks(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	pageRequest, err := getPageRequest(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	filter, err := getFeedbackFilter(request)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, err))
+
+		return
+	}
+
+	result, pagination, err := r.feedbacksService.GetProductFeedbacks(request.Context(), id, pageRequest, filter)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("GetProductFeedbacks: %w", err))
+
+		return
+	}
+
+	responseBody := PaginatedResponse[*models.Feedback]{
+		TotalPages: pagination.TotalPages,
+		PageSize:   pageRequest.PageSize,
+		NextCursor: pagination.NextCursor,
+		Data:       result,
+		Page:       pageRequest.Page,
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) getFeedbackStats(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	responseBody, err := r.feedbacksService.GetFeedbackStats(request.Context(), id)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("GetFeedbackStats: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) getShopFeedbackStats(writer http.ResponseWriter, request *http.Request) {
+	responseBody := r.feedbacksService.GetShopFeedbackStats(request.Context())
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) getFeedbackCounters(writer http.ResponseWriter, request *http.Request) {
+	responseBody := r.feedbacksService.GetFeedbackCounters(request.Context())
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) getFeedbackSimulator(writer http.ResponseWriter, request *http.Request) {
+	responseBody := r.feedbacksService.GetFeedbackSimulator(request.Context())
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) setFeedbackSimulator(writer http.ResponseWriter, request *http.Request) {
+	var settings models.SimulatorSettings
+	if err := r.decodeBody(writer, request, &settings); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	responseBody, err := r.feedbacksService.SetFeedbackSimulator(request.Context(), settings)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("SetFeedbackSimulator: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) markFeedbacksRead(writer http.ResponseWriter, request *http.Request) {
+	var input models.MarkReadInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	responseBody, err := r.feedbacksService.MarkFeedbacksRead(request.Context(), input)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("MarkFeedbacksRead: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(responseBody)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, http.StatusOK, buf)
+}
+
+func (r *Router) addFeedbackReply(writer http.ResponseWriter, request *http.Request) {
+	r.saveFeedbackReply(writer, request, http.StatusCreated, r.feedbacksService.AddFeedbackReply)
+}
+
+func (r *Router) updateFeedbackReply(writer http.ResponseWriter, request *http.Request) {
+	r.saveFeedbackReply(writer, request, http.StatusOK, r.feedbacksService.UpdateFeedbackReply)
+}
+
+func (r *Router) saveFeedbackReply(
+	writer http.ResponseWriter,
+	request *http.Request,
+	code int,
+	save func(ctx context.Context, feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error),
+) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	var input models.FeedbackReplyInput
+	if err := r.decodeBody(writer, request, &input); err != nil {
+		r.sendErrorResponse(writer, request, err)
+
+		return
+	}
+
+	reply, err := save(request.Context(), id, input)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("saveFeedbackReply: %w", err))
+
+		return
+	}
+
+	buf, err := json.Marshal(reply)
+	if err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, err))
+
+		return
+	}
+
+	r.sendResponse(writer, request, code, buf)
+}
+
+func (r *Router) deleteFeedbackReply(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if id == "" {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrBadRequest, errEmptyID))
+
+		return
+	}
+
+	if err := r.feedbacksService.DeleteFeedbackReply(request.Context(), id); err != nil {
+		r.sendErrorResponse(writer, request, fmt.Errorf("DeleteFeedbackReply: %w", err))
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Router) decodeBody(writer http.ResponseWriter, request *http.Request, dst any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, r.maxRequestBodySize))
+	if err := decoder.Decode(dst); err != nil {
+		return fmt.Errorf("%w: %w: %w", models.ErrBadRequest, errInvalidBody, err)
+	}
+
+	return nil
+}
+
+// getPageRequest reads page, pageSize and cursor. With a cursor the page number is ignored
+// and reported as 0.
+func getPageRequest(request *http.Request) (models.PageRequest, error) {
+	query := request.URL.Query()
+
+	pageRequest := models.PageRequest{
+		Page:     1,
+		PageSize: models.DefaultPageSize,
+		Cursor:   query.Get("cursor"),
+	}
+
+	if pageSizeParameter := query.Get("pageSize"); pageSizeParameter != "" {
+		pageSize, err := strconv.Atoi(pageSizeParameter)
+		if err != nil {
+			return pageRequest, fmt.Errorf("%w: %w", errInvalidPageSize, err)
+		}
+
+		if pageSize <= 0 || pageSize > models.MaxPageSize {
+			return pageRequest, fmt.Errorf("%w: must be from 1 to %d", errInvalidPageSize, models.MaxPageSize)
+		}
+
+		pageRequest.PageSize = pageSize
+	}
+
+	if pageRequest.Cursor != "" {
+		pageRequest.Page = 0
+
+		return pageRequest, nil
+	}
+
+	if pageParameter := query.Get("page"); pageParameter != "" {
+		page, err := strconv.Atoi(pageParameter)
+		if err != nil {
+			return pageRequest, fmt.Errorf("%w: %w", errInvalidPageNumber, err)
+		}
+
+		if page <= 0 {
+			return pageRequest, fmt.Errorf("%w: %d", errInvalidPageNumber, page)
+		}
+
+		pageRequest.Page = page
+	}
+
+	return pageRequest, nil
+}
+
+func getProductFilter(request *http.Request) (models.ProductFilter, error) {
+	query := request.URL.Query()
+
+	filter := models.ProductFilter{
+		Search: strings.TrimSpace(query.Get("search")),
+	}
+
+	for _, value := range query["category"] {
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				filter.Categories = append(filter.Categories, category)
+			}
+		}
+	}
+
+	var err error
+
+	if filter.MinPrice, err = getOptionalFloat(query, "minPrice"); err != nil {
+		return filter, err
+	}
+
+	if filter.MaxPrice, err = getOptionalFloat(query, "maxPrice"); err != nil {
+		return filter, err
+	}
+
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, fmt.Errorf("%w: minPrice must not be greater than maxPrice", errInvalidParameter)
+	}
+
+	if filter.HasDiscount, err = getOptionalBool(query, "hasDiscount"); err != nil {
+		return filter, err
+	}
+
+	if filter.Removable, err = getOptionalBool(query, "removable"); err != nil {
+		return filter, err
+	}
+
+	if filter.Since, filter.Until, err = getPeriod(query); err != nil {
+		return filter, err
+	}
+
+	filter.Sort, filter.Descending, err = getSortOrder(query, models.ProductSortFields)
+
+	return filter, err
+}
+
+func getFeedbackFilter(request *http.Request) (models.FeedbackFilter, error) {
+	query := request.URL.Query()
+
+	var filter models.FeedbackFilter
+
+	for _, value := range query["rating"] {
+		for _, parameter := range strings.Split(value, ",") {
+			rating, err := strconv.Atoi(strings.TrimSpace(parameter))
+			if err != nil || rating < 1 || rating > 5 {
+				return filter, fmt.Errorf("%w: rating must be from 1 to 5", errInvalidParameter)
+			}
+
+			filter.Ratings = append(filter.Ratings, rating)
+		}
+	}
+
+	var err error
+
+	if filter.IsRefund, err = getOptionalBool(query, "isRefund"); err != nil {
+		return filter, err
+	}
+
+	if filter.HasPhotos, err = getOptionalBool(query, "hasPhotos"); err != nil {
+		return filter, err
+	}
+
+	if filter.HasReply, err = getOptionalBool(query, "hasReply"); err != nil {
+		return filter, err
+	}
+
+	if filter.Unread, err = getOptionalBool(query, "unread"); err != nil {
+		return filter, err
+	}
+
+	unanswered, err := getOptionalBool(query, "unanswered")
+	if err != nil {
+		return filter, err
+	}
+
+	if unanswered != nil {
+		hasReply := !*unanswered
+		if filter.HasReply != nil && *filter.HasReply != hasReply {
+			return filter, fmt.Errorf("%w: hasReply contradicts unanswered", errInvalidParameter)
+		}
+
+		filter.HasReply = &hasReply
+	}
+
+	if filter.Since, filter.Until, err = getPeriod(query); err != nil {
+		return filter, err
+	}
+
+	filter.Sort, filter.Descending, err = getSortOrder(query, models.FeedbackSortFields)
+
+	return filter, err
+}
+
+func getOrderFilter(request *http.Request) (models.OrderFilter, error) {
+	query := request.URL.Query()
+
+	filter := models.OrderFilter{
+		ProductID: query.Get("productId"),
+		Search:    query.Get("search"),
+	}
+
+	for _, value := range query["status"] {
+		for _, parameter := range strings.Split(value, ",") {
+			status := strings.TrimSpace(parameter)
+			if !slices.Contains(models.OrderStatuses, status) {
+				return filter, fmt.Errorf("%w: status must be one of %s",
+					errInvalidParameter, strings.Join(models.OrderStatuses, ", "))
+			}
+
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	var err error
+
+	if filter.Since, filter.Until, err = getPeriod(query); err != nil {
+		return filter, err
+	}
+
+	filter.Sort, filter.Descending, err = getSortOrder(query, models.OrderSortFields)
+
+	return filter, err
+}
+
+func getRefundFilter(request *http.Request) (models.RefundFilter, error) {
+	query := request.URL.Query()
+
+	filter := models.RefundFilter{
+		OrderID: query.Get("orderId"),
+	}
+
+	for _, value := range query["status"] {
+		for _, parameter := range strings.Split(value, ",") {
+			status := strings.TrimSpace(parameter)
+			if !slices.Contains(models.RefundStatuses, status) {
+				return filter, fmt.Errorf("%w: status must be one of %s",
+					errInvalidParameter, strings.Join(models.RefundStatuses, ", "))
+			}
+
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	var err error
+
+	filter.Sort, filter.Descending, err = getSortOrder(query, models.RefundSortFields)
+
+	return filter, err
+}
+
+func getStockMovementFilter(request *http.Request) (models.StockMovementFilter, error) {
+	query := request.URL.Query()
+
+	var filter models.StockMovementFilter
+
+	for _, value := range query["type"] {
+		for _, parameter := range strings.Split(value, ",") {
+			movementType := strings.TrimSpace(parameter)
+			if !slices.Contains(models.StockMovementTypes, movementType) {
+				return filter, fmt.Errorf("%w: type must be one of %s",
+					errInvalidParameter, strings.Join(models.StockMovementTypes, ", "))
+			}
+
+			filter.Types = append(filter.Types, movementType)
+		}
+	}
+
+	var err error
+
+	filter.Sort, filter.Descending, err = getSortOrder(query, models.StockMovementSortFields)
+
+	return filter, err
+}
+
+// getChartQuery reads the chart range, from and to are dates or RFC 3339 timestamps.
+func getChartQuery(request *http.Request) (models.ChartQuery, error) {
+	query := request.URL.Query()
+
+	chart := models.ChartQuery{
+		Granularity: query.Get("granularity"),
+	}
+
+	if chart.Granularity != "" && !slices.Contains(models.ChartGranularities, chart.Granularity) {
+		return chart, fmt.Errorf("%w: granularity must be one of %s",
+			errInvalidParameter, strings.Join(models.ChartGranularities, ", "))
+	}
+
+	var err error
+
+	if chart.From, err = getOptionalDate(query, "from"); err != nil {
+		return chart, err
+	}
+
+	if chart.To, err = getOptionalDate(query, "to"); err != nil {
+		return chart, err
+	}
+
+	if chart.From != nil && chart.To != nil && chart.From.After(*chart.To) {
+		return chart, fmt.Errorf("%w: from must not be after to", errInvalidParameter)
+	}
+
+	return chart, nil
+}
+
+func getSortOrder(query url.Values, fields []string) (sort string, descending bool, err error) {
+	sort = query.Get("sort")
+	if sort != "" && !slices.Contains(fields, sort) {
+		return "", false, fmt.Errorf("%w: sort must be one of %s", errInvalidParameter, strings.Join(fields, ", "))
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+		return sort, false, nil
+	case "desc":
+		return sort, true, nil
+	default:
+		return "", false, fmt.Errorf("%w: order must be asc or desc", errInvalidParameter)
+	}
+}
+
+func getOptionalFloat(query url.Values, name string) (*float64, error) {
+	parameter := query.Get(name)
+	if parameter == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseFloat(parameter, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errInvalidParameter, name, err)
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("%w: %s must be a finite number", errInvalidParameter, name)
+	}
+
+	return &value, nil
+}
+
+// getPeriod reads since and until in RFC 3339 format.
+func getPeriod(query url.Values) (since, until *time.Time, err error) {
+	if since, err = getOptionalTime(query, "since"); err != nil {
+		return nil, nil, err
+	}
+
+	if until, err = getOptionalTime(query, "until"); err != nil {
+		return nil, nil, err
+	}
+
+	// equal bounds are allowed and just select nothing, since until is exclusive
+	if since != nil && until != nil && since.After(*until) {
+		return nil, nil, fmt.Errorf("%w: since must not be after until", errInvalidParameter)
+	}
+
+	return since, until, nil
+}
+
+func getOptionalTime(query url.Values, name string) (*time.Time, error) {
+	parameter := query.Get(name)
+	if parameter == "" {
+		return nil, nil
+	}
+
+	value, err := time.Parse(time.RFC3339, parameter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errInvalidParameter, name, err)
+	}
+
+	return &value, nil
+}
+
+// getOptionalDate reads a date in the server time zone or an RFC 3339 timestamp.
+func getOptionalDate(query url.Values, name string) (*time.Time, error) {
+	parameter := query.Get(name)
+	if parameter == "" {
+		return nil, nil
+	}
+
+	if value, err := time.ParseInLocation(time.DateOnly, parameter, time.Local); err == nil {
+		return &value, nil
+	}
+
+	return getOptionalTime(query, name)
+}
+
+func getOptionalBool(query url.Values, name string) (*bool, error) {
+	parameter := query.Get(name)
+	if parameter == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseBool(parameter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errInvalidParameter, name, err)
 	}
 
-	return page, nil
+	return &value, nil
 }
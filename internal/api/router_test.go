@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+
+	"seller-pages/internal/config"
+	"seller-pages/internal/models"
+	"seller-pages/internal/service"
+)
+
+const (
+	seedProductsCount = 10
+
+	testCategory = "Электроника"
+	student      = "student"
+	teacher      = "teacher"
+)
+
+type RouterSuite struct {
+	suite.Suite
+
+	key      *rsa.PrivateKey
+	products *service.ProductIsolationService
+	router   *Router
+	baseURL  string
+}
+
+func TestRouter(t *testing.T) {
+	suite.Run(t, &RouterSuite{})
+}
+
+func (s *RouterSuite) SetupSuite() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+
+	s.key = key
+}
+
+func (s *RouterSuite) SetupTest() {
+	categories, err := service.NewCategoryRegistry([]models.Category{
+		{ID: "tech", Name: "Техника"},
+		{
+			ID:       "electronics",
+			Name:     testCategory,
+			ParentID: "tech",
+			Names:    []string{"Ноутбук"},
+			Images:   []string{"image"},
+			MinPrice: 100,
+			MaxPrice: 200,
+		},
+	})
+	s.Require().NoError(err)
+
+	dir := s.T().TempDir()
+	feedbacksPath := filepath.Join(dir, "feedbacks.json")
+	feedbacksIndexPath := filepath.Join(dir, "feedbacksPerProduct.json")
+	s.Require().NoError(os.WriteFile(feedbacksPath, []byte("{}"), 0o600))
+	s.Require().NoError(os.WriteFile(feedbacksIndexPath, []byte("{}"), 0o600))
+
+	logger := zap.NewNop().Sugar()
+
+	feedbacks, err := service.NewFeedbackService(feedbacksPath, feedbacksIndexPath, categories, service.SystemClock, logger)
+	s.Require().NoError(err)
+
+	seed := make([]models.Product, seedProductsCount)
+	for i := range seed {
+		seed[i] = models.Product{
+			ID:          fmt.Sprintf("product-%02d", i),
+			Name:        fmt.Sprintf("Product %d", i),
+			Article:     fmt.Sprintf("ART-%04d", i),
+			Category:    testCategory,
+			IsRemovable: true,
+			Price:       float64(100 + i),
+
+			WarehouseQuantity: 5,
+		}
+	}
+
+	s.products = service.NewProductIsolationService(
+		seed,
+		feedbacks,
+		categories,
+		service.SystemClock,
+		service.NewEventBus(logger),
+		nil,
+		config.SandboxOpts{},
+		logger,
+	)
+
+	s.serve(s.products)
+}
+
+func (s *RouterSuite) TearDownTest() {
+	s.Require().NoError(s.router.Close())
+}
+
+// serve starts a router with the events service on a random port.
+func (s *RouterSuite) serve(events EventsService) {
+	s.serveWith(config.ServerOpts{
+		ReadTimeout:          10,
+		WriteTimeout:         10,
+		IdleTimeout:          10,
+		MaxRequestBodySizeMb: 1,
+		EventsHeartbeat:      1,
+	}, events)
+}
+
+// serveWith starts a router with the server options and the events service on a random port.
+func (s *RouterSuite) serveWith(opts config.ServerOpts, events EventsService) {
+	auth := NewAuthMiddleware(&s.key.PublicKey, s.products, zap.NewNop().Sugar(), nil)
+
+	s.router = NewRouter(
+		opts,
+		s.products,
+		s.products,
+		s.products,
+		s.products,
+		s.products,
+		events,
+		s.products,
+		nil,
+		auth.JWTAuth,
+		auth.Authenticate,
+		zap.NewNop().Sugar(),
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+
+	s.baseURL = "http://" + listener.Addr().String()
+
+	router := s.router
+	go func() {
+		_ = router.Serve(listener)
+	}()
+}
+
+// token signs a token like the token service does.
+func (s *RouterSuite) token(nickname string, isTeacher bool) string {
+	claims := models.AuthTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			Issuer:   teacher,
+			ID:       uuid.NewString(),
+			IssuedAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+		Nickname:  nickname,
+		IsTeacher: isTeacher,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(s.key)
+	s.Require().NoError(err)
+
+	return token
+}
+
+// do sends the request with the token and headers, body is marshalled to JSON unless it's a string.
+// It returns the status code and the response body.
+func (s *RouterSuite) do(method, path, token string, body any, headers ...string) (int, []byte) {
+	var reader io.Reader
+
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(body)
+	default:
+		buf, err := json.Marshal(body)
+		s.Require().NoError(err)
+
+		reader = bytes.NewBuffer(buf)
+	}
+
+	request, err := http.NewRequest(method, s.baseURL+path, reader)
+	s.Require().NoError(err)
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	defer response.Body.Close()
+
+	buf, err := io.ReadAll(response.Body)
+	s.Require().NoError(err)
+
+	return response.StatusCode, buf
+}
+
+// decode unmarshals a response body into T.
+func decode[T any](s *RouterSuite, buf []byte) T {
+	var result T
+	s.Require().NoError(json.Unmarshal(buf, &result), string(buf))
+
+	return result
+}
+
+func (s *RouterSuite) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.router.Shutdown(ctx)
+}
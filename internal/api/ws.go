@@ -0,0 +1,366 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	wsAuthTimeout    = 10 * time.Second
+	wsWriteTimeout   = 10 * time.Second
+	wsMaxMessageSize = 4096
+)
+
+// Topics clients subscribe to, each event belongs to one topic except resync, which is always sent.
+const (
+	topicProducts = "products"
+	topicFeedback = "feedback"
+	topicOrders   = "orders"
+	topicRefunds  = "refunds"
+	topicBalance  = "balance"
+)
+
+// Client messages.
+const (
+	wsAuth        = "auth"
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+)
+
+// Server messages.
+const (
+	wsAuthorized = "authorized"
+	wsSubscribed = "subscribed"
+	wsEvent      = "event"
+	wsError      = "error"
+)
+
+var (
+	errWebSocketAuth      = errors.New("first message must be auth")
+	errUnknownCommand     = errors.New("unknown command")
+	errUnknownTopic       = errors.New("unknown topic")
+	errServerShuttingDown = errors.New("server is shutting down")
+
+	topics = []string{topicProducts, topicFeedback, topicOrders, topicRefunds, topicBalance}
+
+	// the token is not a cookie, so the origin check protects nothing here, as with CORS
+	upgrader = websocket.Upgrader{
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+)
+
+type wsClientMessage struct {
+	Type   string   `json:"type"`
+	Token  string   `json:"token,omitempty"`
+	ActAs  string   `json:"actAs,omitempty"`
+	Topics []string `json:"topics,omitempty"`
+}
+
+// wsCommand is a client message or the reason it can't be decoded.
+type wsCommand struct {
+	message wsClientMessage
+	err     error
+}
+
+type wsServerMessage struct {
+	Type     string          `json:"type"`
+	Nickname string          `json:"nickname,omitempty"`
+	Topics   []string        `json:"topics,omitempty"`
+	ID       uint64          `json:"id,omitempty"`
+	Event    string          `json:"event,omitempty"`
+	Topic    string          `json:"topic,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// connTracker counts hijacked connections, which http.Server.Shutdown doesn't wait for.
+type connTracker struct {
+	active  sync.WaitGroup
+	closing bool
+
+	mu sync.Mutex
+}
+
+// add registers a connection, it fails once the server is shutting down.
+func (t *connTracker) add() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closing {
+		return false
+	}
+
+	t.active.Add(1)
+
+	return true
+}
+
+func (t *connTracker) done() {
+	t.active.Done()
+}
+
+// wait blocks until all connections are closed or ctx is done.
+func (t *connTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	t.closing = true
+	t.mu.Unlock()
+
+	closed := make(chan struct{})
+
+	go func() {
+		t.active.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("connections are still open: %w", ctx.Err())
+	}
+}
+
+// Shutdown gracefully stops the server and waits for WebSocket connections to close.
+func (r *Router) Shutdown(ctx context.Context) error {
+	err := r.Server.Shutdown(ctx)
+
+	return errors.Join(err, r.connections.wait(ctx))
+}
+
+// serveWebSocket pushes changes of the caller's sandbox over a WebSocket. The client authenticates
+// with the Authorization header or with the auth message first, then subscribes to topics.
+func (r *Router) serveWebSocket(writer http.ResponseWriter, request *http.Request) {
+	if !r.connections.add() {
+		r.sendErrorResponse(writer, request, fmt.Errorf("%w: %w", models.ErrInternalServer, errServerShuttingDown))
+
+		return
+	}
+	defer r.connections.done()
+
+	conn, err := upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		// the upgrader has already replied with an error
+		r.logger.Warnf("can't upgrade to websocket: %v", err)
+
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+
+	ctx, err := r.authenticateWebSocket(conn, request)
+	if err != nil {
+		r.logger.Warnf("websocket authentication failed: %v", err)
+		r.closeWebSocket(conn, websocket.ClosePolicyViolation, err.Error())
+
+		return
+	}
+
+	_, events, cancel := r.eventsService.SubscribeEvents(ctx, 0)
+	defer cancel()
+
+	if err := writeWebSocket(conn, wsServerMessage{
+		Type:     wsAuthorized,
+		Nickname: models.SandboxOwnerFromContext(ctx),
+	}); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	commands := r.readWebSocket(conn, done)
+
+	ping := time.NewTicker(r.heartbeat())
+	defer ping.Stop()
+
+	subscribed := make(map[string]bool, len(topics))
+
+	for {
+		var err error
+
+		select {
+		case <-r.shutdown:
+			r.closeWebSocket(conn, websocket.CloseGoingAway, errServerShuttingDown.Error())
+
+			return
+		case command, ok := <-commands:
+			if !ok {
+				return
+			}
+
+			reply := wsServerMessage{Type: wsError}
+			if command.err != nil {
+				reply.Error = fmt.Sprintf("%s: %s", errInvalidBody, command.err)
+			} else {
+				reply = handleCommand(command.message, subscribed)
+			}
+
+			err = writeWebSocket(conn, reply)
+		case event, ok := <-events:
+			if !ok {
+				r.closeWebSocket(conn, websocket.CloseTryAgainLater, "too many events, reconnect")
+
+				return
+			}
+
+			topic := eventTopic(event.Type)
+			if topic != "" && !subscribed[topic] {
+				continue
+			}
+
+			err = writeWebSocket(conn, wsServerMessage{
+				Type:  wsEvent,
+				ID:    event.ID,
+				Event: event.Type,
+				Topic: topic,
+				Data:  event.Data,
+			})
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *Router) authenticateWebSocket(conn *websocket.Conn, request *http.Request) (context.Context, error) {
+	if authorization := request.Header.Get("Authorization"); authorization != "" {
+		return r.authenticate(request.Context(), request.URL.Path, authorization, request.Header.Get(actAsHeader))
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(wsAuthTimeout)); err != nil {
+		return nil, err
+	}
+
+	var message wsClientMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		return nil, fmt.Errorf("%w: %w", errWebSocketAuth, err)
+	}
+
+	if message.Type != wsAuth {
+		return nil, errWebSocketAuth
+	}
+
+	return r.authenticate(request.Context(), request.URL.Path, "Bearer "+message.Token, message.ActAs)
+}
+
+// readWebSocket reads client commands until the connection fails or done is closed.
+// A client which stops answering pings is disconnected by the read deadline.
+func (r *Router) readWebSocket(conn *websocket.Conn, done <-chan struct{}) <-chan wsCommand {
+	commands := make(chan wsCommand)
+	pongTimeout := 2 * r.heartbeat()
+
+	extendDeadline := func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	}
+
+	_ = extendDeadline("")
+	conn.SetPongHandler(extendDeadline)
+
+	go func() {
+		defer close(commands)
+
+		for {
+			var command wsCommand
+
+			err := conn.ReadJSON(&command.message)
+
+			var (
+				syntaxErr *json.SyntaxError
+				typeErr   *json.UnmarshalTypeError
+			)
+
+			switch {
+			case errors.As(err, &syntaxErr) || errors.As(err, &typeErr):
+				// the message is consumed, so the connection is still usable
+				command.err = err
+			case err != nil:
+				return
+			}
+
+			select {
+			case commands <- command:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return commands
+}
+
+// handleCommand changes the subscribed topics and returns the reply to the client.
+func handleCommand(command wsClientMessage, subscribed map[string]bool) wsServerMessage {
+	if command.Type != wsSubscribe && command.Type != wsUnsubscribe {
+		return wsServerMessage{Type: wsError, Error: fmt.Sprintf("%s: %s", errUnknownCommand, command.Type)}
+	}
+
+	for _, topic := range command.Topics {
+		if !slices.Contains(topics, topic) {
+			return wsServerMessage{Type: wsError, Error: fmt.Sprintf("%s: %s", errUnknownTopic, topic)}
+		}
+	}
+
+	for _, topic := range command.Topics {
+		subscribed[topic] = command.Type == wsSubscribe
+	}
+
+	reply := wsServerMessage{Type: wsSubscribed, Topics: []string{}}
+
+	for _, topic := range topics {
+		if subscribed[topic] {
+			reply.Topics = append(reply.Topics, topic)
+		}
+	}
+
+	return reply
+}
+
+// eventTopic returns the topic of the event type, empty for events sent to everyone.
+func eventTopic(eventType string) string {
+	kind, _, _ := strings.Cut(eventType, ".")
+
+	switch kind {
+	case "product":
+		return topicProducts
+	case "feedback":
+		return topicFeedback
+	case "order":
+		return topicOrders
+	case "refund":
+		return topicRefunds
+	case "balance":
+		return topicBalance
+	default:
+		return ""
+	}
+}
+
+func (r *Router) closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+	if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		r.logger.Warnf("can't close websocket: %v", err)
+	}
+}
+
+func writeWebSocket(conn *websocket.Conn, message wsServerMessage) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+
+	return conn.WriteJSON(message)
+}
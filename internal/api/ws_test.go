@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"seller-pages/internal/models"
+)
+
+// stubEvents hands the same channel to every subscriber.
+type stubEvents struct {
+	events chan models.Event
+}
+
+func (e *stubEvents) SubscribeEvents(context.Context, uint64) ([]models.Event, <-chan models.Event, func()) {
+	return nil, e.events, func() {}
+}
+
+func (s *RouterSuite) TestWebSocketHeaderAuth() {
+	conn := s.dial(http.Header{"Authorization": {"Bearer " + s.token(student, false)}})
+
+	s.Equal(wsServerMessage{Type: wsAuthorized, Nickname: student}, s.readWebSocket(conn))
+}
+
+func (s *RouterSuite) TestWebSocketFirstMessageAuth() {
+	conn := s.dial(nil)
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsAuth, Token: s.token(student, false)}))
+	s.Equal(wsServerMessage{Type: wsAuthorized, Nickname: student}, s.readWebSocket(conn))
+
+	conn = s.dial(nil)
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsSubscribe, Topics: []string{topicProducts}}))
+	s.Equal(websocket.ClosePolicyViolation, s.closeCode(conn), "first message must be auth")
+
+	conn = s.dial(nil)
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsAuth, Token: "invalid"}))
+	s.Equal(websocket.ClosePolicyViolation, s.closeCode(conn))
+}
+
+func (s *RouterSuite) TestWebSocketActAs() {
+	code, _ := s.do(http.MethodGet, "/api/products", s.token(student, false), nil)
+	s.Require().Equal(http.StatusOK, code)
+
+	conn := s.dial(nil)
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsAuth, Token: s.token(teacher, true), ActAs: student}))
+	s.Equal(wsServerMessage{Type: wsAuthorized, Nickname: student}, s.readWebSocket(conn))
+
+	conn = s.dial(http.Header{
+		"Authorization": {"Bearer " + s.token("neighbour", false)},
+		actAsHeader:     {student},
+	})
+	s.Equal(websocket.ClosePolicyViolation, s.closeCode(conn), "students can't act as others")
+
+	conn = s.dial(nil)
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsAuth, Token: s.token("neighbour", false), ActAs: student}))
+	s.Equal(websocket.ClosePolicyViolation, s.closeCode(conn))
+}
+
+func (s *RouterSuite) TestWebSocketSubscriptions() {
+	token := s.token(student, false)
+	conn := s.dial(http.Header{"Authorization": {"Bearer " + token}})
+	s.Require().Equal(wsAuthorized, s.readWebSocket(conn).Type)
+
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsSubscribe, Topics: []string{topicProducts, topicOrders}}))
+	s.Equal(wsServerMessage{Type: wsSubscribed, Topics: []string{topicProducts, topicOrders}}, s.readWebSocket(conn))
+
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsSubscribe, Topics: []string{"unknown"}}))
+	s.Equal(wsError, s.readWebSocket(conn).Type)
+
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: "unknown"}))
+	s.Equal(wsError, s.readWebSocket(conn).Type)
+
+	s.Require().NoError(conn.WriteMessage(websocket.TextMessage, []byte(`{"type": }`)))
+	s.Equal(wsError, s.readWebSocket(conn).Type, "invalid message must not close the connection")
+
+	code, _ := s.do(http.MethodPost, "/api/products/generate", token, nil)
+	s.Require().Equal(http.StatusOK, code)
+
+	event := s.readWebSocket(conn)
+	s.Equal(wsEvent, event.Type)
+	s.Equal(models.EventProductCreated, event.Event)
+	s.Equal(topicProducts, event.Topic)
+
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsUnsubscribe, Topics: []string{topicProducts}}))
+	s.Equal(wsServerMessage{Type: wsSubscribed, Topics: []string{topicOrders}}, s.readWebSocket(conn))
+
+	code, _ = s.do(http.MethodPost, "/api/products/generate", token, nil)
+	s.Require().Equal(http.StatusOK, code)
+
+	s.Require().NoError(conn.WriteJSON(wsClientMessage{Type: wsSubscribe, Topics: []string{topicFeedback}}))
+	s.Equal(
+		wsServerMessage{Type: wsSubscribed, Topics: []string{topicFeedback, topicOrders}},
+		s.readWebSocket(conn),
+		"events of unsubscribed topics must not be sent",
+	)
+}
+
+func (s *RouterSuite) TestWebSocketClosesClientFallenBehind() {
+	events := &stubEvents{events: make(chan models.Event)}
+
+	s.Require().NoError(s.router.Close())
+	s.serve(events)
+
+	conn := s.dial(http.Header{"Authorization": {"Bearer " + s.token(student, false)}})
+	s.Require().Equal(wsAuthorized, s.readWebSocket(conn).Type)
+
+	close(events.events)
+
+	s.Equal(websocket.CloseTryAgainLater, s.closeCode(conn))
+}
+
+func (s *RouterSuite) TestShutdownClosesWebSockets() {
+	conn := s.dial(http.Header{"Authorization": {"Bearer " + s.token(student, false)}})
+	s.Require().Equal(wsAuthorized, s.readWebSocket(conn).Type)
+
+	s.Require().NoError(s.shutdown(), "shutdown must wait for the connection to close")
+	s.Equal(websocket.CloseGoingAway, s.closeCode(conn))
+
+	_, _, err := websocket.DefaultDialer.Dial(s.webSocketURL(), nil)
+	s.Error(err, "new connections must be refused")
+}
+
+func (s *RouterSuite) webSocketURL() string {
+	return "ws" + strings.TrimPrefix(s.baseURL, "http") + "/api/ws"
+}
+
+// dial opens a WebSocket closed at the end of the test.
+func (s *RouterSuite) dial(header http.Header) *websocket.Conn {
+	conn, response, err := websocket.DefaultDialer.Dial(s.webSocketURL(), header)
+	s.Require().NoError(err)
+	s.Require().NoError(response.Body.Close())
+
+	s.T().Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return conn
+}
+
+func (s *RouterSuite) readWebSocket(conn *websocket.Conn) wsServerMessage {
+	s.Require().NoError(conn.SetReadDeadline(time.Now().Add(2 * time.Second)))
+
+	var message wsServerMessage
+	s.Require().NoError(conn.ReadJSON(&message))
+
+	return message
+}
+
+// closeCode reads until the server closes the connection and returns the close code.
+func (s *RouterSuite) closeCode(conn *websocket.Conn) int {
+	s.Require().NoError(conn.SetReadDeadline(time.Now().Add(2 * time.Second)))
+
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+
+		var closeErr *websocket.CloseError
+		s.Require().True(errors.As(err, &closeErr), "connection must be closed by the server: %v", err)
+
+		return closeErr.Code
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"seller-pages/internal/api"
 	"seller-pages/internal/config"
 	"seller-pages/internal/service"
+	"seller-pages/internal/storage"
 	"seller-pages/pkg/runner"
 )
 
@@ -17,7 +18,6 @@ type Application struct {
 	cfg *config.Config
 
 	productService  *service.ProductIsolationService
-	balanceService  *service.BalanceService
 	tokenService    *service.TokenService
 	feedbackService *service.FeedbackService
 	logger          *zap.SugaredLogger
@@ -42,6 +42,8 @@ func (a *Application) Start(ctx context.Context) error {
 		return err
 	}
 
+	a.initWorkers(ctx)
+
 	if err := a.initRouter(ctx); err != nil {
 		return err
 	}
@@ -138,34 +140,67 @@ func (a *Application) initLogger() error {
 }
 
 func (a *Application) initServices() error {
-	var err error
+	categories, err := service.NewCategoryRegistry(a.cfg.Categories)
+	if err != nil {
+		return fmt.Errorf("can't create category registry: %w", err)
+	}
 
 	a.feedbackService, err = service.NewFeedbackService(
 		"data/feedbacks.json",
 		"data/feedbacksPerProduct.json",
+		categories,
+		service.SystemClock,
 		a.logger,
 	)
 	if err != nil {
 		return fmt.Errorf("can't create feedback service: %w", err)
 	}
 
-	a.productService = service.NewProductIsolationService(a.cfg.InitialProductsData, a.feedbackService, a.logger)
+	sandboxStorage, err := storage.NewFileStorage(a.cfg.SandboxesPath)
+	if err != nil {
+		return fmt.Errorf("can't create sandbox storage: %w", err)
+	}
+
+	a.productService = service.NewProductIsolationService(
+		a.cfg.InitialProductsData,
+		a.feedbackService,
+		categories,
+		service.SystemClock,
+		service.NewEventBus(a.logger),
+		sandboxStorage,
+		a.cfg.SandboxOpts,
+		a.logger,
+	)
+
+	if err := a.productService.Restore(); err != nil {
+		return fmt.Errorf("can't restore sandboxes: %w", err)
+	}
 
-	a.balanceService = service.NewBalanceService()
 	a.tokenService = service.NewTokenService(a.cfg.PrivateKey, a.cfg.CreatedTokensPath)
 
 	return nil
 }
 
+func (a *Application) initWorkers(ctx context.Context) {
+	runner.RunWorker(ctx, a.productService.RunJanitor, &a.wg)
+	runner.RunWorker(ctx, a.productService.RunSimulator, &a.wg)
+}
+
 func (a *Application) initRouter(ctx context.Context) error {
-	authMiddleware := api.NewAuthMiddleware(a.cfg.PublicKey, a.logger, a.cfg.RevokedTokens).JWTAuth
+	auth := api.NewAuthMiddleware(a.cfg.PublicKey, a.productService, a.logger, a.cfg.RevokedTokens)
 
 	router := api.NewRouter(
 		a.cfg.ServerOpts,
 		a.productService,
-		a.balanceService,
+		a.productService,
+		a.productService,
+		a.productService,
+		a.productService,
+		a.productService,
+		a.productService,
 		a.tokenService,
-		authMiddleware,
+		auth.JWTAuth,
+		auth.Authenticate,
 		a.logger,
 	)
 
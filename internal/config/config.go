@@ -12,6 +12,7 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/golang-jwt/jwt/v5"
@@ -34,10 +35,13 @@ type Config struct {
 	RevokedTokens []string
 
 	InitialProductsData []models.Product
+	Categories          []models.Category
 
 	ServerOpts        ServerOpts
+	SandboxOpts       SandboxOpts
 	FeedbacksPath     string
 	CreatedTokensPath string
+	SandboxesPath     string
 }
 
 func GetConfig(logger *zap.SugaredLogger) (*Config, error) {
@@ -48,8 +52,17 @@ func GetConfig(logger *zap.SugaredLogger) (*Config, error) {
 			WriteTimeout:         60,
 			IdleTimeout:          60,
 			MaxRequestBodySizeMb: 1,
+			EventsHeartbeat:      15,
+		},
+		SandboxOpts: SandboxOpts{
+			IdleTTL:         2 * time.Hour,
+			MaxCount:        200,
+			JanitorInterval: time.Minute,
+			SaveInterval:    5 * time.Second,
+			SimulatorTick:   time.Second,
 		},
 		CreatedTokensPath: "data/createdTokens.csv",
+		SandboxesPath:     "data/sandboxes",
 	}
 
 	products, err := getInitData[models.Product]("data/products.json", logger)
@@ -59,6 +72,13 @@ func GetConfig(logger *zap.SugaredLogger) (*Config, error) {
 
 	cfg.InitialProductsData = products
 
+	categories, err := getInitData[models.Category]("data/categories.json", logger)
+	if err != nil {
+		return nil, fmt.Errorf("can't get categories: %w", err)
+	}
+
+	cfg.Categories = categories
+
 	bannedTokens, err := getInitData[string]("data/blocked_tokens.txt", logger)
 	if err != nil {
 		return nil, fmt.Errorf("can't get banned tokens: %w", err)
@@ -86,6 +106,22 @@ type ServerOpts struct {
 	WriteTimeout         int `json:"write_timeout"`
 	IdleTimeout          int `json:"idle_timeout"`
 	MaxRequestBodySizeMb int `json:"max_request_body_size_mb"`
+	// EventsHeartbeat is seconds between keep-alive comments in the events stream.
+	EventsHeartbeat int `json:"events_heartbeat"`
+}
+
+// SandboxOpts limits the number of sandboxes kept in memory.
+// Evicted sandboxes stay in the storage and are loaded again on the next request.
+// Simulator options set how often the feedback simulator checks sandboxes and its default rate.
+type SandboxOpts struct {
+	IdleTTL         time.Duration `env:"SANDBOX_IDLE_TTL"`
+	MaxCount        int           `env:"SANDBOX_MAX_COUNT"`
+	JanitorInterval time.Duration `env:"SANDBOX_JANITOR_INTERVAL"`
+	// SaveInterval batches saves of changed sandboxes, without it they are saved only on eviction and shutdown.
+	SaveInterval time.Duration `env:"SANDBOX_SAVE_INTERVAL"`
+
+	SimulatorTick            time.Duration `env:"SANDBOX_SIMULATOR_TICK"`
+	SimulatorDefaultInterval time.Duration `env:"SANDBOX_SIMULATOR_INTERVAL"`
 }
 
 // ParsePubKey public keys loader for github.com/caarlos0/env/v11 lib.
@@ -143,7 +179,7 @@ func ParseRSAPublicKey(content []byte) (*rsa.PublicKey, error) {
 }
 
 type loadable interface {
-	string | models.Product
+	string | models.Product | models.Category
 }
 
 func getInitData[T loadable](filePath string, logger *zap.SugaredLogger) ([]T, error) {
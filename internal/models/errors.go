@@ -1,6 +1,10 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"sort"
+	"strings"
+)
 
 var (
 	ErrBadRequest     = errors.New("bad request")
@@ -8,4 +12,30 @@ var (
 	ErrNotFound       = errors.New("not found")
 	ErrUnauthorized   = errors.New("unauthorized")
 	ErrForbidden      = errors.New("forbidden")
+	ErrConflict       = errors.New("conflict")
 )
+
+// ValidationError describes which fields of a request body are invalid.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field + ": " + e.Fields[field]
+	}
+
+	return ErrBadRequest.Error() + ": validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrBadRequest
+}
@@ -2,50 +2,162 @@ package models
 
 import (
 	"context"
+	"encoding/json"
+	"slices"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type Product struct {
-	ID                string  `json:"id"`
-	Name              string  `json:"name"`
-	Article           string  `json:"article"`
-	Category          string  `json:"category"`
-	Description       string  `json:"description"`
-	ImageURL          string  `json:"imageUrl"`
-	IsRemovable       bool    `json:"isRemovable"`
-	OldPrice          float64 `json:"oldPrice,omitempty"`
-	Price             float64 `json:"price"`
-	Rating            float64 `json:"rating,omitempty"`
-	WarehouseQuantity int     `json:"warehouseQuantity,omitempty"`
-	OrdersCount       int     `json:"ordersCount,omitempty"`
-	RefundsPercent    float64 `json:"refundsPercent,omitempty"`
-}
-type ProductPageInfo struct {
-	ID                string  `json:"id"`
-	Name              string  `json:"name"`
-	Article           string  `json:"article"`
-	Category          string  `json:"category"`
-	Description       string  `json:"description"`
-	ImageURL          string  `json:"imageUrl"`
-	OldPrice          float64 `json:"oldPrice,omitempty"`
-	Price             float64 `json:"price"`
-	Rating            float64 `json:"rating,omitempty"`
-	WarehouseQuantity int     `json:"warehouseQuantity,omitempty"`
-	OrdersCount       int     `json:"ordersCount,omitempty"`
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Article           string    `json:"article"`
+	Category          string    `json:"category"`
+	Description       string    `json:"description"`
+	ImageURL          string    `json:"imageUrl"`
+	IsRemovable       bool      `json:"isRemovable"`
+	OldPrice          float64   `json:"oldPrice,omitempty"`
+	Price             float64   `json:"price"`
+	Rating            float64   `json:"rating,omitempty"`
+	WarehouseQuantity int       `json:"warehouseQuantity,omitempty"`
+	OrdersCount       int       `json:"ordersCount,omitempty"`
+	RefundsCount      int       `json:"refundsCount,omitempty"`
+	RefundsPercent    float64   `json:"refundsPercent,omitempty"`
+	LowStockThreshold int       `json:"lowStockThreshold,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
 }
 
-type ProductPreview struct {
-	ID          string  `json:"id"`
+// ProductInput is a product body sent by the client. Server-side fields
+// (id, rating, orders, refunds) are filled by the service. The stock is not
+// editable, it changes only with stock movements.
+type ProductInput struct {
 	Name        string  `json:"name"`
 	Article     string  `json:"article"`
 	Category    string  `json:"category"`
+	Description string  `json:"description"`
 	ImageURL    string  `json:"imageUrl"`
-	IsRemovable bool    `json:"isRemovable"`
 	OldPrice    float64 `json:"oldPrice,omitempty"`
 	Price       float64 `json:"price"`
 }
 
+// NewProductInput is a product to create along with its initial stock.
+type NewProductInput struct {
+	ProductInput
+
+	WarehouseQuantity int `json:"warehouseQuantity,omitempty"`
+}
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// PageRequest selects a page either by number or, if Cursor is set, right after the cursor.
+type PageRequest struct {
+	Page     int
+	PageSize int
+	Cursor   string
+}
+
+type Pagination struct {
+	TotalPages int
+	NextCursor string
+}
+
+const (
+	SortByPrice       = "price"
+	SortByRating      = "rating"
+	SortByOrdersCount = "ordersCount"
+	SortByName        = "name"
+	SortByCreatedAt   = "createdAt"
+	SortByDate        = "date"
+	SortByTotal       = "total"
+	SortByAmount      = "amount"
+)
+
+var ProductSortFields = []string{
+	SortByPrice,
+	SortByRating,
+	SortByOrdersCount,
+	SortByName,
+	SortByCreatedAt,
+}
+
+var FeedbackSortFields = []string{
+	SortByRating,
+	SortByDate,
+}
+
+var OrderSortFields = []string{
+	SortByCreatedAt,
+	SortByTotal,
+}
+
+var RefundSortFields = []string{
+	SortByCreatedAt,
+	SortByAmount,
+}
+
+// FeedbackFilter narrows and orders feedbacks of a product. Nil fields are not applied.
+type FeedbackFilter struct {
+	Ratings    []int
+	IsRefund   *bool
+	HasPhotos  *bool
+	HasReply   *bool
+	Unread     *bool
+	Since      *time.Time
+	Until      *time.Time
+	Sort       string
+	Descending bool
+}
+
+// ProductFilter narrows and orders the products list. Nil fields are not applied.
+type ProductFilter struct {
+	Search      string
+	Categories  []string
+	MinPrice    *float64
+	MaxPrice    *float64
+	HasDiscount *bool
+	Removable   *bool
+	Since       *time.Time
+	Until       *time.Time
+	Sort        string
+	Descending  bool
+}
+
+type ProductPageInfo struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Article           string    `json:"article"`
+	Category          string    `json:"category"`
+	Description       string    `json:"description"`
+	ImageURL          string    `json:"imageUrl"`
+	OldPrice          float64   `json:"oldPrice,omitempty"`
+	Price             float64   `json:"price"`
+	Rating            float64   `json:"rating,omitempty"`
+	WarehouseQuantity int       `json:"warehouseQuantity,omitempty"`
+	OrdersCount       int       `json:"ordersCount,omitempty"`
+	RefundsCount      int       `json:"refundsCount,omitempty"`
+	RefundsPercent    float64   `json:"refundsPercent,omitempty"`
+	LowStockThreshold int       `json:"lowStockThreshold,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+type ProductPreview struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Article     string    `json:"article"`
+	Category    string    `json:"category"`
+	ImageURL    string    `json:"imageUrl"`
+	IsRemovable bool      `json:"isRemovable"`
+	OldPrice    float64   `json:"oldPrice,omitempty"`
+	Price       float64   `json:"price"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
 func (p *Product) ToPreview() ProductPreview {
 	return ProductPreview{
 		ID:          p.ID,
@@ -56,6 +168,19 @@ func (p *Product) ToPreview() ProductPreview {
 		IsRemovable: p.IsRemovable,
 		OldPrice:    p.OldPrice,
 		Price:       p.Price,
+		CreatedAt:   p.CreatedAt,
+	}
+}
+
+func (p *Product) ToInput() ProductInput {
+	return ProductInput{
+		Name:        p.Name,
+		Article:     p.Article,
+		Category:    p.Category,
+		Description: p.Description,
+		ImageURL:    p.ImageURL,
+		OldPrice:    p.OldPrice,
+		Price:       p.Price,
 	}
 }
 
@@ -72,9 +197,38 @@ func (p *Product) ToPageInfo() ProductPageInfo {
 		Rating:            p.Rating,
 		WarehouseQuantity: p.WarehouseQuantity,
 		OrdersCount:       p.OrdersCount,
+		RefundsCount:      p.RefundsCount,
+		RefundsPercent:    p.RefundsPercent,
+		LowStockThreshold: p.LowStockThreshold,
+		CreatedAt:         p.CreatedAt,
+		UpdatedAt:         p.UpdatedAt,
 	}
 }
 
+// Category is an entry of the category registry. Only categories without children
+// can be assigned to products, the pools are used to generate random products.
+type Category struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	IconURL    string   `json:"iconUrl"`
+	ParentID   string   `json:"parentId,omitempty"`
+	Names      []string `json:"names,omitempty"`
+	Images     []string `json:"images,omitempty"`
+	MinPrice   float64  `json:"minPrice,omitempty"`
+	MaxPrice   float64  `json:"maxPrice,omitempty"`
+	Popularity float64  `json:"popularity,omitempty"`
+}
+
+// CategoryInfo is a node of the categories tree. ProductsCount includes products of child categories.
+type CategoryInfo struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	IconURL       string         `json:"iconUrl"`
+	ParentID      string         `json:"parentId,omitempty"`
+	ProductsCount int            `json:"productsCount"`
+	Children      []CategoryInfo `json:"children,omitempty"`
+}
+
 type BalanceInfo struct {
 	ShopID              string       `json:"shopId"`
 	Balance             float64      `json:"balance"`
@@ -91,12 +245,35 @@ type BalanceInfo struct {
 
 type SaleChartDTO struct {
 	AverageSales float64     `json:"averageSales"`
+	Granularity  string      `json:"granularity"`
 	Data         []SalePoint `json:"data"`
 }
 
+// SalePoint is the sales amount of a period, From and To are its first and last days.
 type SalePoint struct {
 	Amount float64 `json:"amount"`
 	Period string  `json:"period"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+}
+
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+var ChartGranularities = []string{
+	GranularityDay,
+	GranularityWeek,
+	GranularityMonth,
+}
+
+// ChartQuery selects the range and the step of the sales chart. Empty fields take defaults.
+type ChartQuery struct {
+	From        *time.Time
+	To          *time.Time
+	Granularity string
 }
 
 type FeedbackPageInfo struct {
@@ -108,15 +285,339 @@ type FeedbackPageInfo struct {
 	RefundsPercent float64     `json:"refundsPercent,omitempty"`
 	Feedbacks      []*Feedback `json:"feedbacks"`
 }
+
+// FeedbackStats summarizes feedbacks of a product or a whole shop. Percents are from 0 to 100.
+type FeedbackStats struct {
+	Count          int         `json:"count"`
+	RatingCounts   map[int]int `json:"ratingCounts"`
+	AverageRating  float64     `json:"averageRating"`
+	RefundsPercent float64     `json:"refundsPercent"`
+	PhotosPercent  float64     `json:"photosPercent"`
+}
+
 type Feedback struct {
-	ID        string   `json:"id"`
-	BuyerName string   `json:"buyerName"`
-	Rating    int      `json:"rating"`
-	Pros      string   `json:"pros"`
-	Cons      string   `json:"cons"`
-	Comment   string   `json:"comment"`
-	PhotosURL []string `json:"photosURL"`
-	IsRefund  bool     `json:"isRefund"`
+	ID        string         `json:"id"`
+	Sequence  uint64         `json:"sequence"`
+	BuyerName string         `json:"buyerName"`
+	Rating    int            `json:"rating"`
+	Pros      string         `json:"pros"`
+	Cons      string         `json:"cons"`
+	Comment   string         `json:"comment"`
+	PhotosURL []string       `json:"photosURL"`
+	IsRefund  bool           `json:"isRefund"`
+	RefundID  string         `json:"refundId,omitempty"`
+	IsRead    bool           `json:"isRead"`
+	Reply     *FeedbackReply `json:"reply,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+// FeedbackReply is the seller answer to a feedback.
+type FeedbackReply struct {
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type FeedbackReplyInput struct {
+	Text string `json:"text"`
+}
+
+// MarkReadInput selects feedbacks to mark as read: either by ids or all created up to the moment.
+type MarkReadInput struct {
+	IDs  []string   `json:"ids,omitempty"`
+	UpTo *time.Time `json:"upTo,omitempty"`
+}
+
+// SimulatorSettings switch the generator of new feedbacks in a sandbox.
+// IntervalSeconds is the time between two feedbacks, 0 means the default one.
+type SimulatorSettings struct {
+	Enabled         bool `json:"enabled"`
+	IntervalSeconds int  `json:"intervalSeconds"`
+}
+
+// FeedbackCounters are numbers for the feedbacks badge.
+type FeedbackCounters struct {
+	Unread     int `json:"unread"`
+	Unanswered int `json:"unanswered"`
+}
+
+func (f *Feedback) Clone() *Feedback {
+	if f == nil {
+		return nil
+	}
+
+	clone := *f
+	clone.PhotosURL = slices.Clone(f.PhotosURL)
+
+	if f.Reply != nil {
+		reply := *f.Reply
+		clone.Reply = &reply
+	}
+
+	return &clone
+}
+
+const (
+	EventProductCreated  = "product.created"
+	EventProductUpdated  = "product.updated"
+	EventProductDeleted  = "product.deleted"
+	EventProductLowStock = "product.lowStock"
+	EventFeedbackAdded   = "feedback.added"
+	EventFeedbackReplied = "feedback.replied"
+	EventBalanceChanged  = "balance.changed"
+	EventOrderCreated    = "order.created"
+	EventOrderUpdated    = "order.updated"
+	EventRefundRequested = "refund.requested"
+	EventRefundResolved  = "refund.resolved"
+	// EventResync means that some events were lost and the client should reload the data.
+	EventResync = "resync"
+)
+
+// Event is a change in a sandbox. Ids grow within a sandbox, Data is the JSON payload.
+type Event struct {
+	ID   uint64
+	Type string
+	Data json.RawMessage
+}
+
+type ProductDeletedEvent struct {
+	ID string `json:"id"`
+}
+
+// BalanceChangedEvent only tells that the balance changed, clients fetch it when they need it.
+type BalanceChangedEvent struct {
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+type FeedbackAddedEvent struct {
+	ProductID string    `json:"productId"`
+	Feedback  *Feedback `json:"feedback"`
+}
+
+// FeedbackRepliedEvent is sent when a reply is added, changed or deleted. Reply is nil after deletion.
+type FeedbackRepliedEvent struct {
+	FeedbackID string         `json:"feedbackId"`
+	Reply      *FeedbackReply `json:"reply"`
+}
+
+// SandboxSnapshot is the full state of a student's sandbox.
+type SandboxSnapshot struct {
+	CreatedAt      time.Time `json:"createdAt,omitzero"`
+	LastActivityAt time.Time `json:"lastActivityAt,omitzero"`
+
+	Products            []Product            `json:"products"`
+	Feedbacks           map[string]*Feedback `json:"feedbacks"`
+	FeedbacksPerProduct map[string][]string  `json:"feedbacksPerProduct"`
+	Orders              []Order              `json:"orders,omitempty"`
+	Refunds             []Refund             `json:"refunds,omitempty"`
+	StockMovements      []StockMovement      `json:"stockMovements,omitempty"`
+	// ProductSequences keep the order products were added in, so list cursors survive restores and restarts.
+	ProductSequences    map[string]uint64 `json:"productSequences,omitempty"`
+	LastProductSequence uint64            `json:"lastProductSequence,omitempty"`
+}
+
+const (
+	OrderStatusNew        = "new"
+	OrderStatusAssembling = "assembling"
+	OrderStatusShipped    = "shipped"
+	OrderStatusDelivered  = "delivered"
+	OrderStatusCancelled  = "cancelled"
+	OrderStatusRefunded   = "refunded"
+)
+
+var OrderStatuses = []string{
+	OrderStatusNew,
+	OrderStatusAssembling,
+	OrderStatusShipped,
+	OrderStatusDelivered,
+	OrderStatusCancelled,
+	OrderStatusRefunded,
+}
+
+type Order struct {
+	ID        string              `json:"id"`
+	BuyerName string              `json:"buyerName"`
+	Items     []OrderItem         `json:"items"`
+	Total     float64             `json:"total"`
+	Status    string              `json:"status"`
+	History   []OrderStatusChange `json:"history"`
+	CreatedAt time.Time           `json:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+	// RefundedAt is set when the order is refunded, the balance counts the refund on that day.
+	RefundedAt time.Time `json:"refundedAt,omitzero"`
+}
+
+// OrderItem keeps the product name and price at purchase time, they don't follow product edits.
+type OrderItem struct {
+	ProductID string  `json:"productId"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	Quantity  int     `json:"quantity"`
+}
+
+type OrderStatusChange struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// Clone returns a deep copy of the order, so callers can't change the stored one.
+func (o Order) Clone() Order {
+	o.Items = slices.Clone(o.Items)
+	o.History = slices.Clone(o.History)
+
+	return o
+}
+
+// OrderInput is an order placed by a buyer, prices are taken from the products.
+type OrderInput struct {
+	BuyerName string           `json:"buyerName"`
+	Items     []OrderItemInput `json:"items"`
+}
+
+type OrderItemInput struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+type OrderStatusInput struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// OrderFilter narrows and orders the orders list. Empty fields are not applied.
+type OrderFilter struct {
+	Statuses   []string
+	ProductID  string
+	Search     string
+	Since      *time.Time
+	Until      *time.Time
+	Sort       string
+	Descending bool
+}
+
+const (
+	RefundStatusPending  = "pending"
+	RefundStatusApproved = "approved"
+	RefundStatusRejected = "rejected"
+)
+
+var RefundStatuses = []string{
+	RefundStatusPending,
+	RefundStatusApproved,
+	RefundStatusRejected,
+}
+
+// Refund is a buyer request to return a delivered order. FeedbackID is the buyer feedback
+// about the return, if they left one. Resolution is the seller reason to approve or reject it.
+type Refund struct {
+	ID         string    `json:"id"`
+	OrderID    string    `json:"orderId"`
+	FeedbackID string    `json:"feedbackId,omitempty"`
+	BuyerName  string    `json:"buyerName"`
+	Amount     float64   `json:"amount"`
+	Reason     string    `json:"reason"`
+	Status     string    `json:"status"`
+	Resolution string    `json:"resolution,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	ResolvedAt time.Time `json:"resolvedAt,omitzero"`
+}
+
+// RefundInput is a return request sent on behalf of the buyer of the order.
+type RefundInput struct {
+	OrderID    string `json:"orderId"`
+	FeedbackID string `json:"feedbackId,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// RefundResolutionInput approves or rejects a pending refund, the reason is required to reject.
+type RefundResolutionInput struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RefundFilter narrows and orders the refunds list. Empty fields are not applied.
+type RefundFilter struct {
+	Statuses   []string
+	OrderID    string
+	Sort       string
+	Descending bool
+}
+
+const (
+	StockMovementReceipt      = "receipt"
+	StockMovementWriteOff     = "writeOff"
+	StockMovementCorrection   = "correction"
+	StockMovementOrder        = "order"
+	StockMovementCancellation = "cancellation"
+	StockMovementRefund       = "refund"
+)
+
+// StockAdjustmentTypes are movements the seller makes by hand, the others follow orders.
+var StockAdjustmentTypes = []string{
+	StockMovementReceipt,
+	StockMovementWriteOff,
+	StockMovementCorrection,
+}
+
+var StockMovementTypes = []string{
+	StockMovementReceipt,
+	StockMovementWriteOff,
+	StockMovementCorrection,
+	StockMovementOrder,
+	StockMovementCancellation,
+	StockMovementRefund,
+}
+
+var StockMovementSortFields = []string{
+	SortByCreatedAt,
+}
+
+// StockMovement is an entry of the product stock journal. Quantity is the change of the warehouse
+// quantity, negative when stock leaves, QuantityAfter is the warehouse quantity after the movement.
+// Sequence numbers entries of one product journal, it keeps growing when the oldest entries are dropped.
+type StockMovement struct {
+	ID            string    `json:"id"`
+	ProductID     string    `json:"productId"`
+	Sequence      uint64    `json:"sequence"`
+	Type          string    `json:"type"`
+	Quantity      int       `json:"quantity"`
+	QuantityAfter int       `json:"quantityAfter"`
+	Reason        string    `json:"reason,omitempty"`
+	OrderID       string    `json:"orderId,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// StockAdjustmentInput changes the product stock by hand. Quantity is the received or written off amount,
+// for a correction it is the counted warehouse quantity.
+type StockAdjustmentInput struct {
+	Type     string `json:"type"`
+	Quantity int    `json:"quantity"`
+	Reason   string `json:"reason"`
+}
+
+// LowStockThresholdInput sets the warehouse quantity at which the product is low on stock, 0 turns it off.
+type LowStockThresholdInput struct {
+	LowStockThreshold int `json:"lowStockThreshold"`
+}
+
+// StockMovementFilter narrows and orders the stock journal of a product. Empty fields are not applied.
+type StockMovementFilter struct {
+	Types      []string
+	Sort       string
+	Descending bool
+}
+
+// SandboxInfo describes a sandbox for teachers.
+type SandboxInfo struct {
+	Nickname       string    `json:"nickname"`
+	ProductsCount  int       `json:"productsCount"`
+	FeedbacksCount int       `json:"feedbacksCount"`
+	CreatedAt      time.Time `json:"createdAt"`
+	LastActivityAt time.Time `json:"lastActivityAt"`
+	IsLoaded       bool      `json:"isLoaded"`
 }
 
 type AuthTokenClaims struct {
@@ -128,8 +629,20 @@ type AuthTokenClaims struct {
 
 type ContextClaimsKey struct{}
 
+type ContextActAsKey struct{}
+
 func ClaimsFromContext(ctx context.Context) *AuthTokenClaims {
 	claims, _ := ctx.Value(ContextClaimsKey{}).(*AuthTokenClaims)
 
 	return claims
 }
+
+// SandboxOwnerFromContext returns the nickname whose sandbox the request works with:
+// the impersonated student for teachers acting as someone else, the caller otherwise.
+func SandboxOwnerFromContext(ctx context.Context) string {
+	if actAs, ok := ctx.Value(ContextActAsKey{}).(string); ok && actAs != "" {
+		return actAs
+	}
+
+	return ClaimsFromContext(ctx).Nickname
+}
@@ -1,35 +1,224 @@
 package service
 
-import "seller-pages/internal/models"
+import (
+	"cmp"
+	"math"
+	"time"
 
-type BalanceService struct{}
+	"github.com/google/uuid"
 
-func NewBalanceService() *BalanceService {
-	return &BalanceService{}
+	"seller-pages/internal/models"
+)
+
+const balanceGrowPeriod = 30 * 24 * time.Hour
+
+// shopNamespace is the shop id of the former hardcoded balance, shop ids of sandboxes are derived from it.
+var shopNamespace = uuid.MustParse("2619f2da-b3cc-490e-81ad-105323448a78")
+
+// ShopID returns the shop id of the nickname, it is the same for the sandbox across restarts and resets.
+func ShopID(nickname string) string {
+	return uuid.NewSHA1(shopNamespace, []byte(nickname)).String()
+}
+
+// salesVolume sums orders placed within a period, refunded orders included.
+type salesVolume struct {
+	orders        float64
+	refunds       float64
+	amount        float64
+	refundsAmount float64
+}
+
+// unrecordedSales are orders and refunds of a product which are counted in the product but have no records,
+// such as seed ones.
+type unrecordedSales struct {
+	orders  int
+	refunds int
+}
+
+// addUnrecorded counts unrecorded orders and refunds of the product placed within [from, to).
+// Only their numbers are known, so they are spread evenly from the product creation up to now.
+func (v *salesVolume) addUnrecorded(product *models.Product, sales unrecordedSales, now, from, to time.Time) {
+	share := ordersShare(product.CreatedAt, now, from, to)
+	orders := float64(sales.orders) * share
+	refunds := float64(sales.refunds) * share
+
+	v.orders += orders
+	v.refunds += refunds
+	v.amount += orders * product.Price
+	v.refundsAmount += refunds * product.Price
+}
+
+// addOrder counts the order if it was placed within [from, to) and its refund if it was refunded within it.
+func (v *salesVolume) addOrder(order *models.Order, from, to time.Time) {
+	if order.Status == models.OrderStatusCancelled {
+		return
+	}
+
+	if inRange(order.CreatedAt, from, to) {
+		v.orders++
+		v.amount += order.Total
+	}
+
+	if order.Status != models.OrderStatusRefunded {
+		return
+	}
+
+	if inRange(order.RefundedAt, from, to) {
+		v.refunds++
+		v.refundsAmount += order.Total
+	}
 }
 
-func (s *BalanceService) GetBalanceInfo() models.BalanceInfo {
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+// ordersShare returns the part of [createdAt, now] which is within [from, to).
+func ordersShare(createdAt, now, from, to time.Time) float64 {
+	if !createdAt.Before(now) {
+		if !createdAt.Before(from) && createdAt.Before(to) {
+			return 1
+		}
+
+		return 0
+	}
+
+	start, end := createdAt, now
+	if from.After(start) {
+		start = from
+	}
+
+	if to.Before(end) {
+		end = to
+	}
+
+	if !end.After(start) {
+		return 0
+	}
+
+	return float64(end.Sub(start)) / float64(now.Sub(createdAt))
+}
+
+// BalanceInfo returns the seller balance computed from products and feedbacks of the sandbox,
+// with the sales chart over the requested range.
+func (s *ProductService) BalanceInfo(query models.ChartQuery) (models.BalanceInfo, error) {
+	s.productMutex.RLock()
+	defer s.productMutex.RUnlock()
+
+	return s.balance(s.clock.Now(), query)
+}
+
+// balance computes the seller balance at now. Must be called under productMutex.
+func (s *ProductService) balance(now time.Time, query models.ChartQuery) (models.BalanceInfo, error) {
+	query.Granularity = cmp.Or(query.Granularity, models.GranularityMonth)
+
+	periods, err := chartPeriods(query, now)
+	if err != nil {
+		return models.BalanceInfo{}, err
+	}
+
+	monthStart := periodStart(now, models.GranularityMonth)
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	unrecorded := s.unrecordedSales()
+
+	total := s.sales(unrecorded, now, time.Time{}, monthEnd)
+	month := s.sales(unrecorded, now, monthStart, monthEnd)
+	lastPeriod := s.sales(unrecorded, now, now.Add(-balanceGrowPeriod), monthEnd)
+	previousPeriod := s.sales(unrecorded, now, now.Add(-2*balanceGrowPeriod), now.Add(-balanceGrowPeriod))
+
+	chart := make([]salesVolume, len(periods))
+	for i, period := range periods {
+		chart[i] = s.sales(unrecorded, now, period.from, period.to)
+	}
+
 	info := models.BalanceInfo{
-		ShopID:            "2619f2da-b3cc-490e-81ad-105323448a78",
-		Balance:           574229.23,
-		Sales:             97234.1,
-		Income:            85001,
-		ShopRating:        4.87,
-		TotalSalesCount:   24336,
-		TotalRefundsCount: 442,
-		MonthlyRatingGrow: 0.04,
-		MonthlySalesGrow:  447,
+		ShopID:            s.shopID,
+		Balance:           roundMoney(total.amount - total.refundsAmount),
+		Sales:             roundMoney(month.amount),
+		Income:            roundMoney(month.amount - month.refundsAmount),
+		TotalSalesCount:   int(math.Round(total.orders)),
+		TotalRefundsCount: int(math.Round(total.refunds)),
+		MonthlySalesGrow:  int(math.Round(lastPeriod.orders - previousPeriod.orders)),
 		SalesChart: models.SaleChartDTO{
-			Data: []models.SalePoint{
-				{Amount: 97234.1, Period: "Сентябрь"},
-				{Amount: 105000, Period: "Август"},
-				{Amount: 80000, Period: "Июль"},
-				{Amount: 99000, Period: "Июнь"},
-				{Amount: 109000, Period: "Май"},
-			},
+			Granularity: query.Granularity,
+			Data:        make([]models.SalePoint, len(chart)),
 		},
 	}
-	info.TotalRefundsPercent = float32(info.TotalRefundsCount) / float32(info.TotalSalesCount) * 100
-	info.SalesChart.AverageSales = (info.SalesChart.Data[0].Amount + info.SalesChart.Data[1].Amount + info.SalesChart.Data[2].Amount) / 3
-	return info
+
+	if total.orders > 0 {
+		info.TotalRefundsPercent = float32(total.refunds / total.orders * 100)
+	}
+
+	var chartSum float64
+
+	for i, volume := range chart {
+		info.SalesChart.Data[i] = salePoint(periods[i], volume.amount, query.Granularity, now)
+		chartSum += volume.amount
+	}
+
+	info.SalesChart.AverageSales = roundMoney(chartSum / float64(len(chart)))
+
+	stats := s.feedbackService.ShopStats()
+	info.ShopRating = float32(stats.AverageRating)
+
+	if earlier := s.feedbackService.ShopStatsUntil(now.Add(-balanceGrowPeriod)); earlier.Count > 0 && stats.Count > 0 {
+		info.MonthlyRatingGrow = float32(stats.AverageRating - earlier.AverageRating)
+	}
+
+	return info, nil
+}
+
+// unrecordedSales returns orders and refunds of each product which are counted in OrdersCount
+// and RefundsCount but have no records. Must be called under productMutex.
+func (s *ProductService) unrecordedSales() map[string]unrecordedSales {
+	result := make(map[string]unrecordedSales, len(s.products))
+	for _, product := range s.products {
+		result[product.ID] = unrecordedSales{orders: product.OrdersCount, refunds: product.RefundsCount}
+	}
+
+	for _, order := range s.orders {
+		if order.Status == models.OrderStatusCancelled {
+			continue
+		}
+
+		for _, item := range order.Items {
+			sales := result[item.ProductID]
+			sales.orders = max(sales.orders-1, 0)
+
+			if order.Status == models.OrderStatusRefunded {
+				sales.refunds = max(sales.refunds-1, 0)
+			}
+
+			result[item.ProductID] = sales
+		}
+	}
+
+	return result
+}
+
+// sales sums orders placed within [from, to), orders of deleted products included.
+// Must be called under productMutex.
+func (s *ProductService) sales(unrecorded map[string]unrecordedSales, now, from, to time.Time) salesVolume {
+	var result salesVolume
+
+	for _, product := range s.products {
+		result.addUnrecorded(product, unrecorded[product.ID], now, from, to)
+	}
+
+	for _, order := range s.orders {
+		result.addOrder(order, from, to)
+	}
+
+	return result
+}
+
+// publishBalance notifies subscribers that the balance changed. The balance itself is not
+// computed here: it walks all orders, and most mutations happen with nobody watching.
+func (s *ProductService) publishBalance() {
+	s.events.Publish(models.EventBalanceChanged, models.BalanceChangedEvent{ChangedAt: s.clock.Now()})
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
 }
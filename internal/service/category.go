@@ -0,0 +1,261 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	defaultPopularity = 1
+	defaultMinPrice   = 100
+	defaultMaxPrice   = 1000
+)
+
+var errInvalidCategory = errors.New("invalid category")
+
+var (
+	defaultNames = []string{
+		"Товар что надо",
+	}
+	defaultImages = []string{
+		"https://basket-16.wbbasket.ru/vol2574/part257400/257400077/images/big/11.webp",
+		"https://basket-22.wbbasket.ru/vol3704/part370494/370494201/images/big/2.webp",
+		"https://basket-16.wbbasket.ru/vol2619/part261968/261968456/images/big/1.webp",
+		"https://basket-09.wbbasket.ru/vol1207/part120753/120753915/images/big/1.webp",
+	}
+)
+
+// CategoryRegistry is the categories tree shared by all sandboxes. Products refer to
+// categories by name, so names are unique as well as ids. The registry is read-only.
+// A nil registry has no categories, random values then come from the defaults.
+type CategoryRegistry struct {
+	categories []models.Category
+	byName     map[string]*models.Category
+	children   map[string][]*models.Category
+	leaves     []*models.Category
+	leafNames  []string
+}
+
+func NewCategoryRegistry(categories []models.Category) (*CategoryRegistry, error) {
+	result := &CategoryRegistry{
+		categories: categories,
+		byName:     make(map[string]*models.Category, len(categories)),
+		children:   make(map[string][]*models.Category, len(categories)),
+	}
+
+	byID := make(map[string]*models.Category, len(categories))
+
+	for i := range result.categories {
+		category := &result.categories[i]
+
+		if category.ID == "" || category.Name == "" {
+			return nil, fmt.Errorf("%w: category %d has empty id or name", errInvalidCategory, i)
+		}
+
+		if _, has := byID[category.ID]; has {
+			return nil, fmt.Errorf("%w: duplicate id %s", errInvalidCategory, category.ID)
+		}
+
+		if _, has := result.byName[category.Name]; has {
+			return nil, fmt.Errorf("%w: duplicate name %s", errInvalidCategory, category.Name)
+		}
+
+		byID[category.ID] = category
+		result.byName[category.Name] = category
+	}
+
+	for i := range result.categories {
+		category := &result.categories[i]
+		if category.ParentID == "" {
+			continue
+		}
+
+		if _, has := byID[category.ParentID]; !has {
+			return nil, fmt.Errorf("%w: parent %s of %s not found", errInvalidCategory, category.ParentID, category.ID)
+		}
+
+		if err := checkCycle(category, byID); err != nil {
+			return nil, err
+		}
+
+		result.children[category.ParentID] = append(result.children[category.ParentID], category)
+	}
+
+	for i := range result.categories {
+		category := &result.categories[i]
+		if len(result.children[category.ID]) > 0 {
+			continue
+		}
+
+		if err := validateLeafCategory(category); err != nil {
+			return nil, err
+		}
+
+		result.leaves = append(result.leaves, category)
+		result.leafNames = append(result.leafNames, category.Name)
+	}
+
+	if len(result.leaves) == 0 {
+		return nil, fmt.Errorf("%w: no categories for products", errInvalidCategory)
+	}
+
+	return result, nil
+}
+
+func checkCycle(category *models.Category, byID map[string]*models.Category) error {
+	current := category
+
+	for range len(byID) {
+		if current.ParentID == "" {
+			return nil
+		}
+
+		current = byID[current.ParentID]
+	}
+
+	return fmt.Errorf("%w: %s is its own ancestor", errInvalidCategory, category.ID)
+}
+
+func validateLeafCategory(category *models.Category) error {
+	switch {
+	case len(category.Names) == 0 || len(category.Images) == 0:
+		return fmt.Errorf("%w: %s must have names and images", errInvalidCategory, category.ID)
+	case category.MinPrice <= 0 || category.MaxPrice < category.MinPrice:
+		return fmt.Errorf("%w: %s has invalid price range", errInvalidCategory, category.ID)
+	case category.Popularity < 0:
+		return fmt.Errorf("%w: %s has negative popularity", errInvalidCategory, category.ID)
+	default:
+		return nil
+	}
+}
+
+// IsAssignable reports whether products can belong to the category.
+func (r *CategoryRegistry) IsAssignable(name string) bool {
+	return r.leaf(name) != nil
+}
+
+// AssignableNames returns names of categories products can belong to, in registry order.
+func (r *CategoryRegistry) AssignableNames() []string {
+	if r == nil {
+		return nil
+	}
+
+	return r.leafNames
+}
+
+// Tree returns the categories tree, counts are products per category name.
+func (r *CategoryRegistry) Tree(counts map[string]int) []models.CategoryInfo {
+	var roots []models.CategoryInfo
+
+	if r == nil {
+		return roots
+	}
+
+	for i := range r.categories {
+		if r.categories[i].ParentID == "" {
+			roots = append(roots, r.node(&r.categories[i], counts))
+		}
+	}
+
+	return roots
+}
+
+func (r *CategoryRegistry) node(category *models.Category, counts map[string]int) models.CategoryInfo {
+	result := models.CategoryInfo{
+		ID:            category.ID,
+		Name:          category.Name,
+		IconURL:       category.IconURL,
+		ParentID:      category.ParentID,
+		ProductsCount: counts[category.Name],
+	}
+
+	for _, child := range r.children[category.ID] {
+		childInfo := r.node(child, counts)
+
+		result.ProductsCount += childInfo.ProductsCount
+		result.Children = append(result.Children, childInfo)
+	}
+
+	return result
+}
+
+// leaf returns an assignable category by name or nil.
+func (r *CategoryRegistry) leaf(name string) *models.Category {
+	if r == nil {
+		return nil
+	}
+
+	category, has := r.byName[name]
+	if !has || len(r.children[category.ID]) > 0 {
+		return nil
+	}
+
+	return category
+}
+
+// randomCategory picks a category weighted by its popularity, it's empty without categories.
+func (r *CategoryRegistry) randomCategory() string {
+	if r == nil || len(r.leaves) == 0 {
+		return ""
+	}
+
+	var total float64
+	for _, category := range r.leaves {
+		total += popularity(category)
+	}
+
+	point := rand.Float64() * total
+	for _, category := range r.leaves {
+		point -= popularity(category)
+		if point < 0 {
+			return category.Name
+		}
+	}
+
+	return r.leaves[len(r.leaves)-1].Name
+}
+
+func popularity(category *models.Category) float64 {
+	if category.Popularity == 0 {
+		return defaultPopularity
+	}
+
+	return category.Popularity
+}
+
+func (r *CategoryRegistry) randomName(category string) string {
+	names := defaultNames
+	if leaf := r.leaf(category); leaf != nil {
+		names = leaf.Names
+	}
+
+	return names[rand.Intn(len(names))]
+}
+
+func (r *CategoryRegistry) randomImageURL(category string) string {
+	images := defaultImages
+	if leaf := r.leaf(category); leaf != nil {
+		images = leaf.Images
+	}
+
+	return images[rand.Intn(len(images))]
+}
+
+func (r *CategoryRegistry) randomPriceAndOldPrice(category string) (price, oldPrice float64) {
+	minPrice, maxPrice := float64(defaultMinPrice), float64(defaultMaxPrice)
+	if leaf := r.leaf(category); leaf != nil {
+		minPrice, maxPrice = leaf.MinPrice, leaf.MaxPrice
+	}
+
+	price = rand.Float64()*(maxPrice-minPrice) + minPrice
+
+	const probabilityOfEmptyOldPrice = 0.7
+	if rand.Float64() < probabilityOfEmptyOldPrice {
+		oldPrice = price + rand.Float64()*(maxPrice-price)
+	}
+
+	return
+}
@@ -0,0 +1,17 @@
+package service
+
+import "time"
+
+// Clock returns the current time. Services take it as a dependency, so tests control timestamps.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	eventsHistorySize = 100
+	// subscriberBufferSize is how many events a slow client may lag behind before it's disconnected.
+	// It reconnects with Last-Event-ID and gets the missed events from the history.
+	subscriberBufferSize = 32
+)
+
+// EventBus delivers sandbox changes to subscribers of the sandbox owner.
+// A stream lives while its sandbox is loaded or someone is subscribed to it, so clients can resume
+// after the sandbox is evicted as long as they stay connected.
+type EventBus struct {
+	streams map[string]*EventStream
+	logger  *zap.SugaredLogger
+
+	mu sync.Mutex
+}
+
+func NewEventBus(logger *zap.SugaredLogger) *EventBus {
+	return &EventBus{
+		streams: make(map[string]*EventStream),
+		logger:  logger,
+	}
+}
+
+// Stream returns the events stream of the nickname, creating it on first use. Safe to call on a nil bus.
+func (b *EventBus) Stream(nickname string) *EventStream {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stream(nickname)
+}
+
+// Hold returns the events stream of the nickname and keeps it until Release, it's called for loaded sandboxes.
+// Safe to call on a nil bus.
+func (b *EventBus) Hold(nickname string) *EventStream {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream := b.stream(nickname)
+
+	stream.mu.Lock()
+	stream.held = true
+	stream.mu.Unlock()
+
+	return stream
+}
+
+// Release drops the stream of the nickname once it has no subscribers, it's called when the sandbox is unloaded.
+func (b *EventBus) Release(nickname string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream, has := b.streams[nickname]
+	if !has {
+		return
+	}
+
+	stream.mu.Lock()
+	stream.held = false
+	stream.mu.Unlock()
+
+	b.dropUnused(stream)
+}
+
+// Subscribe subscribes to the stream of the nickname, see EventStream.Subscribe.
+// The stream is dropped on cancel if it's not held and has no other subscribers.
+func (b *EventBus) Subscribe(
+	nickname string,
+	lastEventID uint64,
+) (missed []models.Event, events <-chan models.Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream := b.stream(nickname)
+	missed, events, unsubscribe := stream.Subscribe(lastEventID)
+
+	cancel = func() {
+		unsubscribe()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.dropUnused(stream)
+	}
+
+	return missed, events, cancel
+}
+
+// stream returns the stream of the nickname, creating it on first use. Must be called under mu.
+func (b *EventBus) stream(nickname string) *EventStream {
+	stream, has := b.streams[nickname]
+	if !has {
+		stream = &EventStream{
+			nickname:    nickname,
+			subscribers: make(map[chan models.Event]struct{}),
+			logger:      b.logger,
+		}
+		b.streams[nickname] = stream
+	}
+
+	return stream
+}
+
+// dropUnused removes the stream if no sandbox holds it and nobody is subscribed. Must be called under mu.
+func (b *EventBus) dropUnused(stream *EventStream) {
+	stream.mu.Lock()
+	unused := !stream.held && len(stream.subscribers) == 0
+	stream.mu.Unlock()
+
+	if unused && b.streams[stream.nickname] == stream {
+		delete(b.streams, stream.nickname)
+	}
+}
+
+// EventStream keeps the recent events of one sandbox in a ring buffer and fans them out to subscribers.
+// A nil stream discards events, it's used by services outside of sandboxes.
+type EventStream struct {
+	nickname    string
+	history     []models.Event
+	lastID      uint64
+	subscribers map[chan models.Event]struct{}
+	// held is set while the sandbox of the stream is loaded
+	held   bool
+	logger *zap.SugaredLogger
+
+	mu sync.Mutex
+}
+
+// Publish never blocks, so it's safe to call under service locks.
+func (s *EventStream) Publish(eventType string, payload any) {
+	if s == nil {
+		return
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		s.logger.Errorf("can't marshal %s event for nickname %s: %v", eventType, s.nickname, err)
+
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	event := models.Event{ID: s.lastID, Type: eventType, Data: data}
+
+	if len(s.history) == eventsHistorySize {
+		s.history = append(s.history[:0], s.history[1:]...)
+	}
+
+	s.history = append(s.history, event)
+
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Subscribe returns events published after lastEventID and the channel of the next ones.
+// If the missed events are not in the history anymore, a single resync event is returned instead.
+// The channel is closed when the subscriber falls behind, cancel must be called when done.
+func (s *EventStream) Subscribe(lastEventID uint64) (missed []models.Event, events <-chan models.Event, cancel func()) {
+	subscriber := make(chan models.Event, subscriberBufferSize)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribers[subscriber] = struct{}{}
+
+	switch {
+	case lastEventID == 0 || lastEventID == s.lastID:
+	case lastEventID > s.lastID || len(s.history) == 0 || lastEventID+1 < s.history[0].ID:
+		// ids start over after restart, so an id from the future means the history is lost too
+		missed = []models.Event{{ID: s.lastID, Type: models.EventResync, Data: json.RawMessage("null")}}
+	default:
+		missed = append(missed, s.history[lastEventID+1-s.history[0].ID:]...)
+	}
+
+	cancel = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, has := s.subscribers[subscriber]; has {
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+
+	return missed, subscriber, cancel
+}
@@ -6,7 +6,11 @@ import (
 	"io"
 	"math/rand"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -14,18 +18,30 @@ import (
 	"seller-pages/internal/models"
 )
 
+const maxReplyLength = 1000
+
 type FeedbackService struct {
 	feedbacks           map[string]*models.Feedback
 	feedbacksPerProduct map[string][]string
+	categories          *CategoryRegistry
+	clock               Clock
+	events              *EventStream
 
 	logger *zap.SugaredLogger
 	mx     sync.RWMutex
 }
 
-func NewFeedbackService(feedbacksPath, feedbacksIndexPath string, logger *zap.SugaredLogger) (*FeedbackService, error) {
+func NewFeedbackService(
+	feedbacksPath, feedbacksIndexPath string,
+	categories *CategoryRegistry,
+	clock Clock,
+	logger *zap.SugaredLogger,
+) (*FeedbackService, error) {
 	result := &FeedbackService{
 		feedbacks:           make(map[string]*models.Feedback),
 		feedbacksPerProduct: make(map[string][]string),
+		categories:          categories,
+		clock:               clock,
 		logger:              logger,
 		mx:                  sync.RWMutex{},
 	}
@@ -70,10 +86,111 @@ func NewFeedbackService(feedbacksPath, feedbacksIndexPath string, logger *zap.Su
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
+	numberFeedbacks(result.feedbacks, result.feedbacksPerProduct)
+
 	return result, nil
 }
 
-func (s *FeedbackService) GetFeedbacks(product models.Product) models.FeedbackPageInfo {
+// NewFeedbackSandbox creates a feedback service from a sandbox snapshot.
+// The snapshot maps are owned by the service after the call.
+func NewFeedbackSandbox(
+	snapshot models.SandboxSnapshot,
+	categories *CategoryRegistry,
+	clock Clock,
+	events *EventStream,
+	logger *zap.SugaredLogger,
+) *FeedbackService {
+	result := &FeedbackService{
+		feedbacks:           snapshot.Feedbacks,
+		feedbacksPerProduct: snapshot.FeedbacksPerProduct,
+		categories:          categories,
+		clock:               clock,
+		events:              events,
+		logger:              logger,
+	}
+
+	if result.feedbacks == nil {
+		result.feedbacks = make(map[string]*models.Feedback)
+	}
+
+	if result.feedbacksPerProduct == nil {
+		result.feedbacksPerProduct = make(map[string][]string)
+	}
+
+	return result
+}
+
+// ExportTo puts a deep copy of all feedbacks into the snapshot.
+func (s *FeedbackService) ExportTo(snapshot *models.SandboxSnapshot) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	snapshot.Feedbacks = make(map[string]*models.Feedback, len(s.feedbacks))
+	for id, feedback := range s.feedbacks {
+		snapshot.Feedbacks[id] = feedback.Clone()
+	}
+
+	snapshot.FeedbacksPerProduct = make(map[string][]string, len(s.feedbacksPerProduct))
+	for productID, feedbackIDs := range s.feedbacksPerProduct {
+		snapshot.FeedbacksPerProduct[productID] = slices.Clone(feedbackIDs)
+	}
+}
+
+// ImportFrom replaces all feedbacks with a deep copy of the snapshot ones.
+func (s *FeedbackService) ImportFrom(snapshot models.SandboxSnapshot) {
+	feedbacks := make(map[string]*models.Feedback, len(snapshot.Feedbacks))
+	for id, feedback := range snapshot.Feedbacks {
+		feedbacks[id] = feedback.Clone()
+	}
+
+	feedbacksPerProduct := make(map[string][]string, len(snapshot.FeedbacksPerProduct))
+	for productID, feedbackIDs := range snapshot.FeedbacksPerProduct {
+		feedbacksPerProduct[productID] = slices.Clone(feedbackIDs)
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.feedbacks = feedbacks
+	s.feedbacksPerProduct = feedbacksPerProduct
+}
+
+// numberFeedbacks gives seed feedbacks sequences in the product order.
+func numberFeedbacks(feedbacks map[string]*models.Feedback, feedbacksPerProduct map[string][]string) {
+	for _, ids := range feedbacksPerProduct {
+		for i, id := range ids {
+			if feedback, has := feedbacks[id]; has {
+				feedback.Sequence = uint64(i + 1)
+			}
+		}
+	}
+}
+
+// appendFeedback posts the feedback to the product with the next sequence. Must be called under mx.
+func (s *FeedbackService) appendFeedback(productID string, feedback *models.Feedback) {
+	var last uint64
+
+	if ids := s.feedbacksPerProduct[productID]; len(ids) > 0 {
+		if previous, has := s.feedbacks[ids[len(ids)-1]]; has {
+			last = previous.Sequence
+		}
+	}
+
+	feedback.Sequence = last + 1
+
+	s.feedbacks[feedback.ID] = feedback
+	s.feedbacksPerProduct[productID] = append(s.feedbacksPerProduct[productID], feedback.ID)
+}
+
+func (s *FeedbackService) Count() int {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return len(s.feedbacks)
+}
+
+// GetFeedbacks returns the product with copies of its feedbacks matching the filter.
+func (s *FeedbackService) GetFeedbacks(product models.Product, filter models.FeedbackFilter) models.FeedbackPageInfo {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
 
@@ -86,11 +203,13 @@ func (s *FeedbackService) GetFeedbacks(product models.Product) models.FeedbackPa
 		Rating:         product.Rating,
 		OrdersCount:    product.OrdersCount,
 		RefundsPercent: product.RefundsPercent,
-		Feedbacks:      make([]*models.Feedback, len(feedbacks)),
+		Feedbacks:      make([]*models.Feedback, 0, len(feedbacks)),
 	}
 
-	for i, id := range feedbacks {
-		result.Feedbacks[i] = s.feedbacks[id]
+	for _, id := range feedbacks {
+		if feedback := s.feedbacks[id]; matchesFeedbackFilter(feedback, filter) {
+			result.Feedbacks = append(result.Feedbacks, feedback.Clone())
+		}
 	}
 
 	return result
@@ -100,8 +219,11 @@ func (s *FeedbackService) DeleteFeedbacks(productID string) {
 	s.mx.Lock()
 	defer s.mx.Unlock()
 
+	for _, id := range s.feedbacksPerProduct[productID] {
+		delete(s.feedbacks, id)
+	}
+
 	delete(s.feedbacksPerProduct, productID)
-	delete(s.feedbacks, productID)
 }
 
 func (s *FeedbackService) AddFeedbacksToProduct(product models.Product) {
@@ -109,26 +231,256 @@ func (s *FeedbackService) AddFeedbacksToProduct(product models.Product) {
 	defer s.mx.Unlock()
 
 	number := rand.Intn(5)
+	now := s.clock.Now()
+
+	delete(s.feedbacksPerProduct, product.ID)
+
+	for range number {
+		s.appendFeedback(product.ID, s.randomFeedback(product.Category, now))
+	}
+}
+
+// AddRandomFeedback posts one more random feedback to the product and returns its copy.
+func (s *FeedbackService) AddRandomFeedback(product models.Product) *models.Feedback {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	feedback := s.randomFeedback(product.Category, s.clock.Now())
+
+	s.appendFeedback(product.ID, feedback)
+
+	s.events.Publish(models.EventFeedbackAdded, models.FeedbackAddedEvent{ProductID: product.ID, Feedback: feedback})
+
+	return feedback.Clone()
+}
+
+// AddRefundFeedback posts a low rated feedback of the buyer who returns the product and returns its copy.
+func (s *FeedbackService) AddRefundFeedback(product models.Product, buyerName, comment string) *models.Feedback {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	feedback := s.randomFeedback(product.Category, s.clock.Now())
+	feedback.BuyerName = buyerName
+	feedback.Rating = rand.Intn(2) + minFeedbackRating
+	feedback.Pros = getRandomPros(feedback.Rating)
+	feedback.Cons = getRandomCons(feedback.Rating)
+	feedback.Comment = comment
+
+	s.appendFeedback(product.ID, feedback)
+
+	s.events.Publish(models.EventFeedbackAdded, models.FeedbackAddedEvent{ProductID: product.ID, Feedback: feedback})
+
+	return feedback.Clone()
+}
+
+// HasFeedback reports whether the feedback is posted to the product.
+func (s *FeedbackService) HasFeedback(productID, feedbackID string) bool {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return slices.Contains(s.feedbacksPerProduct[productID], feedbackID)
+}
+
+// LinkRefund marks the feedback with the resolved refund, it's a refund feedback only if the refund is approved.
+// Feedbacks deleted with their products are skipped.
+func (s *FeedbackService) LinkRefund(feedbackID, refundID string, approved bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	feedback, has := s.feedbacks[feedbackID]
+	if !has {
+		return
+	}
 
-	feedbackIDs := make([]string, number)
-	for i := range number {
-		id := uuid.NewString()
-		feedbackIDs[i] = id
-
-		rating := rand.Intn(4) + 1
-		s.feedbacks[id] = &models.Feedback{
-			ID:        id,
-			BuyerName: getRandomName(),
-			Rating:    rating,
-			Pros:      getRandomPros(rating),
-			Cons:      getRandomCons(rating),
-			Comment:   getRandomComment(),
-			PhotosURL: getRandomPhotosForFeedback(rand.Intn(4), product.Category),
-			IsRefund:  rand.Float64() < 0.3,
+	// returned feedbacks are copies, so the feedback can be changed in place
+	feedback.RefundID = refundID
+	feedback.IsRefund = approved
+	feedback.UpdatedAt = s.clock.Now()
+}
+
+func (s *FeedbackService) randomFeedback(category string, now time.Time) *models.Feedback {
+	rating := rand.Intn(4) + 1
+
+	return &models.Feedback{
+		ID:        uuid.NewString(),
+		BuyerName: getRandomName(),
+		Rating:    rating,
+		Pros:      getRandomPros(rating),
+		Cons:      getRandomCons(rating),
+		Comment:   getRandomComment(),
+		PhotosURL: s.getRandomPhotosForFeedback(rand.Intn(4), category),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// AddReply stores the seller reply to the feedback. A feedback can have only one reply.
+func (s *FeedbackService) AddReply(feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error) {
+	if err := validateReplyInput(input); err != nil {
+		return models.FeedbackReply{}, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	feedback, has := s.feedbacks[feedbackID]
+	if !has {
+		return models.FeedbackReply{}, fmt.Errorf("%w: feedback %s not found", models.ErrNotFound, feedbackID)
+	}
+
+	if feedback.Reply != nil {
+		return models.FeedbackReply{}, fmt.Errorf("%w: feedback %s already has a reply", models.ErrConflict, feedbackID)
+	}
+
+	now := s.clock.Now()
+
+	feedback.Reply = &models.FeedbackReply{
+		Text:      strings.TrimSpace(input.Text),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	// the seller has obviously read the feedback they answer
+	feedback.IsRead = true
+
+	s.events.Publish(models.EventFeedbackReplied, models.FeedbackRepliedEvent{FeedbackID: feedbackID, Reply: feedback.Reply})
+
+	return *feedback.Reply, nil
+}
+
+func (s *FeedbackService) UpdateReply(feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error) {
+	if err := validateReplyInput(input); err != nil {
+		return models.FeedbackReply{}, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	feedback, err := s.getReplied(feedbackID)
+	if err != nil {
+		return models.FeedbackReply{}, err
+	}
+
+	// returned feedbacks are copies, so the reply can be replaced in place
+	feedback.Reply = &models.FeedbackReply{
+		Text:      strings.TrimSpace(input.Text),
+		CreatedAt: feedback.Reply.CreatedAt,
+		UpdatedAt: s.clock.Now(),
+	}
+
+	s.events.Publish(models.EventFeedbackReplied, models.FeedbackRepliedEvent{FeedbackID: feedbackID, Reply: feedback.Reply})
+
+	return *feedback.Reply, nil
+}
+
+func (s *FeedbackService) DeleteReply(feedbackID string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	feedback, err := s.getReplied(feedbackID)
+	if err != nil {
+		return err
+	}
+
+	feedback.Reply = nil
+
+	s.events.Publish(models.EventFeedbackReplied, models.FeedbackRepliedEvent{FeedbackID: feedbackID})
+
+	return nil
+}
+
+// MarkRead marks feedbacks as read and returns the updated counters.
+// Unknown ids fail the whole request, so nothing is marked partially.
+func (s *FeedbackService) MarkRead(input models.MarkReadInput) (models.FeedbackCounters, error) {
+	if err := validateMarkReadInput(input); err != nil {
+		return models.FeedbackCounters{}, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, id := range input.IDs {
+		if _, has := s.feedbacks[id]; !has {
+			return models.FeedbackCounters{}, fmt.Errorf("%w: feedback %s not found", models.ErrNotFound, id)
+		}
+	}
+
+	for _, id := range input.IDs {
+		s.feedbacks[id].IsRead = true
+	}
+
+	if input.UpTo != nil {
+		for _, feedback := range s.feedbacks {
+			if !feedback.CreatedAt.After(*input.UpTo) {
+				feedback.IsRead = true
+			}
 		}
 	}
 
-	s.feedbacksPerProduct[product.ID] = feedbackIDs
+	return s.counters(), nil
+}
+
+func (s *FeedbackService) Counters() models.FeedbackCounters {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.counters()
+}
+
+// counters must be called under mx.
+func (s *FeedbackService) counters() models.FeedbackCounters {
+	var result models.FeedbackCounters
+
+	for _, feedback := range s.feedbacks {
+		if !feedback.IsRead {
+			result.Unread++
+		}
+
+		if feedback.Reply == nil {
+			result.Unanswered++
+		}
+	}
+
+	return result
+}
+
+// getReplied returns a feedback which has a reply. Must be called under mx.
+func (s *FeedbackService) getReplied(feedbackID string) (*models.Feedback, error) {
+	feedback, has := s.feedbacks[feedbackID]
+	if !has {
+		return nil, fmt.Errorf("%w: feedback %s not found", models.ErrNotFound, feedbackID)
+	}
+
+	if feedback.Reply == nil {
+		return nil, fmt.Errorf("%w: feedback %s has no reply", models.ErrNotFound, feedbackID)
+	}
+
+	return feedback, nil
+}
+
+func validateMarkReadInput(input models.MarkReadInput) error {
+	switch {
+	case len(input.IDs) == 0 && input.UpTo == nil:
+		return &models.ValidationError{Fields: map[string]string{"ids": "ids or upTo must be set"}}
+	case len(input.IDs) > 0 && input.UpTo != nil:
+		return &models.ValidationError{Fields: map[string]string{"upTo": "must not be set together with ids"}}
+	default:
+		return nil
+	}
+}
+
+func validateReplyInput(input models.FeedbackReplyInput) error {
+	text := strings.TrimSpace(input.Text)
+
+	switch {
+	case text == "":
+		return &models.ValidationError{Fields: map[string]string{"text": "must not be empty"}}
+	case utf8.RuneCountInString(text) > maxReplyLength:
+		return &models.ValidationError{Fields: map[string]string{
+			"text": fmt.Sprintf("must be at most %d characters", maxReplyLength),
+		}}
+	default:
+		return nil
+	}
 }
 
 func getRandomName() string {
@@ -223,10 +575,10 @@ func getRandomComment() string {
 	return comment
 }
 
-func getRandomPhotosForFeedback(n int, category string) []string {
+func (s *FeedbackService) getRandomPhotosForFeedback(n int, category string) []string {
 	result := make([]string, n)
 	for i := range result {
-		result[i] = randomImageURL(category)
+		result[i] = s.categories.randomImageURL(category)
 	}
 
 	return result
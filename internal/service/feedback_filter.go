@@ -0,0 +1,64 @@
+package service
+
+import (
+	"slices"
+
+	"seller-pages/internal/models"
+)
+
+// FilterFeedbacks returns copies of the product feedbacks matching the filter, in the order they were added.
+func (s *FeedbackService) FilterFeedbacks(productID string, filter models.FeedbackFilter) []*models.Feedback {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	ids := s.feedbacksPerProduct[productID]
+	result := make([]*models.Feedback, 0, len(ids))
+
+	for _, id := range ids {
+		if feedback := s.feedbacks[id]; matchesFeedbackFilter(feedback, filter) {
+			result = append(result, feedback.Clone())
+		}
+	}
+
+	return result
+}
+
+func matchesFeedbackFilter(feedback *models.Feedback, filter models.FeedbackFilter) bool {
+	if len(filter.Ratings) > 0 && !slices.Contains(filter.Ratings, feedback.Rating) {
+		return false
+	}
+
+	if filter.IsRefund != nil && feedback.IsRefund != *filter.IsRefund {
+		return false
+	}
+
+	if filter.HasPhotos != nil && (len(feedback.PhotosURL) > 0) != *filter.HasPhotos {
+		return false
+	}
+
+	if filter.HasReply != nil && (feedback.Reply != nil) != *filter.HasReply {
+		return false
+	}
+
+	if filter.Unread != nil && feedback.IsRead == *filter.Unread {
+		return false
+	}
+
+	return inPeriod(feedback.CreatedAt, filter.Since, filter.Until)
+}
+
+// feedbackKey returns the position of the feedback in a list sorted by the filter field.
+func feedbackKey(filter models.FeedbackFilter) func(feedback *models.Feedback) sortKey {
+	return func(feedback *models.Feedback) sortKey {
+		key := sortKey{Sequence: feedback.Sequence}
+
+		switch filter.Sort {
+		case models.SortByRating:
+			key.Number = float64(feedback.Rating)
+		case models.SortByDate:
+			key.Number = float64(feedback.CreatedAt.UnixMicro())
+		}
+
+		return key
+	}
+}
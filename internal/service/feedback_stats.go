@@ -0,0 +1,96 @@
+package service
+
+import (
+	"time"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	minFeedbackRating = 1
+	maxFeedbackRating = 5
+)
+
+// Stats returns statistics of the product feedbacks. The refunds percent is not known to feedbacks,
+// it is filled by the product service from orders.
+func (s *FeedbackService) Stats(productID string) models.FeedbackStats {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	stats := newStatsCollector()
+	for _, id := range s.feedbacksPerProduct[productID] {
+		stats.add(s.feedbacks[id])
+	}
+
+	return stats.result()
+}
+
+// ShopStats returns statistics of all feedbacks in the sandbox.
+func (s *FeedbackService) ShopStats() models.FeedbackStats {
+	return s.ShopStatsUntil(time.Time{})
+}
+
+// ShopStatsUntil returns statistics of feedbacks created before until, zero until means all of them.
+func (s *FeedbackService) ShopStatsUntil(until time.Time) models.FeedbackStats {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	stats := newStatsCollector()
+	for _, ids := range s.feedbacksPerProduct {
+		for _, id := range ids {
+			if feedback := s.feedbacks[id]; until.IsZero() || feedback.CreatedAt.Before(until) {
+				stats.add(feedback)
+			}
+		}
+	}
+
+	return stats.result()
+}
+
+type statsCollector struct {
+	stats models.FeedbackStats
+
+	ratingsSum int
+	withPhotos int
+}
+
+func newStatsCollector() *statsCollector {
+	result := &statsCollector{
+		stats: models.FeedbackStats{
+			RatingCounts: make(map[int]int, maxFeedbackRating),
+		},
+	}
+
+	for rating := minFeedbackRating; rating <= maxFeedbackRating; rating++ {
+		result.stats.RatingCounts[rating] = 0
+	}
+
+	return result
+}
+
+func (c *statsCollector) add(feedback *models.Feedback) {
+	if feedback == nil {
+		return
+	}
+
+	c.stats.Count++
+	c.stats.RatingCounts[feedback.Rating]++
+	c.ratingsSum += feedback.Rating
+
+	if len(feedback.PhotosURL) > 0 {
+		c.withPhotos++
+	}
+}
+
+func (c *statsCollector) result() models.FeedbackStats {
+	if c.stats.Count == 0 {
+		return c.stats
+	}
+
+	count := float64(c.stats.Count)
+
+	c.stats.AverageRating = float64(c.ratingsSum) / count
+	c.stats.PhotosPercent = float64(c.withPhotos) / count * 100
+
+	return c.stats
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"seller-pages/internal/models"
+)
+
+// mergePatch applies a JSON merge patch (RFC 7386) to target and returns the patched copy.
+func mergePatch[T any](target T, patch map[string]any) (T, error) {
+	var result T
+
+	buf, err := json.Marshal(target)
+	if err != nil {
+		return result, fmt.Errorf("can't marshal target: %w", err)
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(buf, &document); err != nil {
+		return result, fmt.Errorf("can't unmarshal target: %w", err)
+	}
+
+	buf, err = json.Marshal(mergeObjects(document, patch))
+	if err != nil {
+		return result, fmt.Errorf("can't marshal patched document: %w", err)
+	}
+
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return result, fmt.Errorf("can't unmarshal patched document: %w", err)
+	}
+
+	return result, nil
+}
+
+// validatePatchFields rejects patch keys which are not JSON fields of T, so a mistyped or
+// read-only field isn't silently ignored.
+func validatePatchFields[T any](patch map[string]any) error {
+	target := reflect.TypeFor[T]()
+	known := make(map[string]struct{}, target.NumField())
+
+	for i := range target.NumField() {
+		field := target.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		known[name] = struct{}{}
+	}
+
+	fields := make(map[string]string)
+
+	for key := range patch {
+		if _, has := known[key]; !has {
+			fields[key] = "unknown or read-only field"
+		}
+	}
+
+	if len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+func mergeObjects(target, patch map[string]any) map[string]any {
+	if target == nil {
+		target = make(map[string]any, len(patch))
+	}
+
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+
+			continue
+		}
+
+		patchObject, ok := value.(map[string]any)
+		if !ok {
+			target[key] = value
+
+			continue
+		}
+
+		targetObject, _ := target[key].(map[string]any)
+		target[key] = mergeObjects(targetObject, patchObject)
+	}
+
+	return target
+}
@@ -0,0 +1,485 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	maxOrderReasonLength = 500
+	// maxOrders caps orders of a sandbox. Orders are never dropped, since balance and refunds
+	// are computed from them, so a full sandbox has to be reset to get new orders.
+	maxOrders = 10000
+
+	maxRandomQuantity     = 3
+	secondItemProbability = 0.2
+)
+
+// orderTransitions lists the statuses an order can move to from its current status.
+var orderTransitions = map[string][]string{
+	models.OrderStatusNew:        {models.OrderStatusAssembling, models.OrderStatusCancelled},
+	models.OrderStatusAssembling: {models.OrderStatusShipped, models.OrderStatusCancelled},
+	models.OrderStatusShipped:    {models.OrderStatusDelivered},
+	models.OrderStatusDelivered:  {models.OrderStatusRefunded},
+}
+
+// listedOrder is an order copy with its position in the sandbox orders.
+type listedOrder struct {
+	models.Order
+
+	sequence uint64
+}
+
+// setOrders replaces the orders with copies of orders. Must be called under productMutex.
+func (s *ProductService) setOrders(orders []models.Order) {
+	s.orders = make([]*models.Order, 0, len(orders))
+	s.orderIndex = make(map[string]int, len(orders))
+
+	for _, order := range orders {
+		s.appendOrder(order.Clone())
+	}
+}
+
+// appendOrder adds the order to the end of the list, orders are never removed,
+// so the position is also the order sequence. Must be called under productMutex.
+func (s *ProductService) appendOrder(order models.Order) {
+	s.orderIndex[order.ID] = len(s.orders)
+	s.orders = append(s.orders, &order)
+}
+
+// GetOrders returns a page of orders matching the filter, in the filter order.
+func (s *ProductService) GetOrders(
+	pageRequest models.PageRequest,
+	filter models.OrderFilter,
+) ([]models.Order, models.Pagination, error) {
+	s.productMutex.RLock()
+	orders := s.filterOrders(filter)
+	s.productMutex.RUnlock()
+
+	order := sortOrder{Field: filter.Sort, Descending: filter.Descending}
+	sortItems(orders, order, orderKey(filter))
+
+	page, pagination, err := paginate(orders, pageRequest, order, orderKey(filter))
+	if err != nil {
+		return nil, pagination, err
+	}
+
+	result := make([]models.Order, len(page))
+	for i, listed := range page {
+		result[i] = listed.Order
+	}
+
+	return result, pagination, nil
+}
+
+func (s *ProductService) GetOrderByID(orderID string) (models.Order, error) {
+	s.productMutex.RLock()
+	defer s.productMutex.RUnlock()
+
+	index, has := s.orderIndex[orderID]
+	if !has {
+		return models.Order{}, fmt.Errorf("%w: order %s not found", models.ErrNotFound, orderID)
+	}
+
+	return s.orders[index].Clone(), nil
+}
+
+// createOrder creates a new order at current prices and takes its items from the warehouse.
+// Either all items are in stock and reserved, or nothing changes. Orders come only from
+// the generator and the simulator, so it must be called under productMutex with a valid input.
+func (s *ProductService) createOrder(input models.OrderInput) (models.Order, error) {
+	if len(s.orders) >= maxOrders {
+		return models.Order{}, fmt.Errorf("%w: sandbox already has %d orders, reset it to place new ones",
+			models.ErrConflict, maxOrders)
+	}
+
+	now := s.clock.Now()
+
+	order := models.Order{
+		ID:        uuid.NewString(),
+		BuyerName: strings.TrimSpace(input.BuyerName),
+		Items:     make([]models.OrderItem, len(input.Items)),
+		Status:    models.OrderStatusNew,
+		History:   []models.OrderStatusChange{{Status: models.OrderStatusNew, ChangedAt: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	fields := make(map[string]string)
+
+	for i, item := range input.Items {
+		product, has := s.productIndex[item.ProductID]
+		if !has {
+			fields[fmt.Sprintf("items[%d].productId", i)] = "product not found"
+
+			continue
+		}
+
+		if product.WarehouseQuantity < item.Quantity {
+			return models.Order{}, fmt.Errorf("%w: only %d of product %s left in stock",
+				models.ErrConflict, product.WarehouseQuantity, product.ID)
+		}
+
+		order.Items[i] = models.OrderItem{
+			ProductID: product.ID,
+			Name:      product.Name,
+			Price:     product.Price,
+			Quantity:  item.Quantity,
+		}
+		order.Total += product.Price * float64(item.Quantity)
+	}
+
+	if len(fields) > 0 {
+		return models.Order{}, &models.ValidationError{Fields: fields}
+	}
+
+	order.Total = roundMoney(order.Total)
+
+	// every item is checked above, so the stock is reserved for the whole order or not at all.
+	// The reservation is the stock decrement itself: orders are cancelled only before shipping,
+	// which returns the items, and shipping doesn't touch the stock, so the warehouse quantity
+	// is always what is left for new orders and there is nothing to release separately.
+	for _, item := range order.Items {
+		s.moveStock(item.ProductID, models.StockMovement{
+			Type:     models.StockMovementOrder,
+			Quantity: -item.Quantity,
+			OrderID:  order.ID,
+		}, func(product *models.Product) {
+			product.OrdersCount++
+			setRefundsPercent(product)
+		})
+	}
+
+	s.appendOrder(order)
+
+	s.events.Publish(models.EventOrderCreated, order)
+	s.publishBalance()
+
+	return order.Clone(), nil
+}
+
+// ChangeOrderStatus moves the order along its lifecycle. Cancelled and refunded orders
+// return their items to the warehouse, cancelled ones are no longer counted as orders.
+// Orders are refunded only by approving a refund request.
+func (s *ProductService) ChangeOrderStatus(orderID string, input models.OrderStatusInput) (models.Order, error) {
+	if err := validateOrderStatusInput(input); err != nil {
+		return models.Order{}, err
+	}
+
+	if input.Status == models.OrderStatusRefunded {
+		return models.Order{}, fmt.Errorf("%w: orders are refunded by approving a refund request", models.ErrConflict)
+	}
+
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	index, has := s.orderIndex[orderID]
+	if !has {
+		return models.Order{}, fmt.Errorf("%w: order %s not found", models.ErrNotFound, orderID)
+	}
+
+	return s.changeOrderStatus(index, input)
+}
+
+// changeOrderStatus must be called under productMutex with a valid input.
+func (s *ProductService) changeOrderStatus(index int, input models.OrderStatusInput) (models.Order, error) {
+	updated := s.orders[index].Clone()
+
+	if !slices.Contains(orderTransitions[updated.Status], input.Status) {
+		return models.Order{}, fmt.Errorf("%w: order can't move from %s to %s", models.ErrConflict, updated.Status, input.Status)
+	}
+
+	now := s.clock.Now()
+
+	updated.Status = input.Status
+	updated.History = append(updated.History, models.OrderStatusChange{
+		Status:    input.Status,
+		Reason:    strings.TrimSpace(input.Reason),
+		ChangedAt: now,
+	})
+	updated.UpdatedAt = now
+
+	if input.Status == models.OrderStatusRefunded {
+		updated.RefundedAt = now
+	}
+
+	if input.Status == models.OrderStatusCancelled || input.Status == models.OrderStatusRefunded {
+		movement := models.StockMovement{
+			Type:    models.StockMovementCancellation,
+			Reason:  strings.TrimSpace(input.Reason),
+			OrderID: updated.ID,
+		}
+		if input.Status == models.OrderStatusRefunded {
+			movement.Type = models.StockMovementRefund
+		}
+
+		for _, item := range updated.Items {
+			movement.Quantity = item.Quantity
+
+			// items of deleted products have nowhere to return to
+			s.moveStock(item.ProductID, movement, func(product *models.Product) {
+				if input.Status == models.OrderStatusCancelled {
+					product.OrdersCount--
+				} else {
+					product.RefundsCount++
+				}
+
+				setRefundsPercent(product)
+			})
+		}
+	}
+
+	s.orders[index] = &updated
+
+	s.events.Publish(models.EventOrderUpdated, updated)
+
+	if input.Status == models.OrderStatusCancelled || input.Status == models.OrderStatusRefunded {
+		s.publishBalance()
+	}
+
+	return updated.Clone(), nil
+}
+
+// AddRandomOrder places an order of a random buyer for in-stock products. Products of categories
+// with more orders are bought more often.
+func (s *ProductService) AddRandomOrder() (models.Order, error) {
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	input, ok := s.randomOrderInput()
+	if !ok {
+		return models.Order{}, fmt.Errorf("%w: no products in stock", models.ErrConflict)
+	}
+
+	return s.createOrder(input)
+}
+
+// randomOrderInput picks one or sometimes two in-stock products. A category is picked
+// in proportion to the orders of its products, then a product of it. Must be called under productMutex.
+func (s *ProductService) randomOrderInput() (models.OrderInput, bool) {
+	categoryOrders := make(map[string]int)
+	inStock := make(map[string][]*models.Product)
+
+	for _, product := range s.products {
+		categoryOrders[product.Category] += product.OrdersCount
+
+		if product.WarehouseQuantity > 0 {
+			inStock[product.Category] = append(inStock[product.Category], product)
+		}
+	}
+
+	if len(inStock) == 0 {
+		return models.OrderInput{}, false
+	}
+
+	categories := make([]string, 0, len(inStock))
+	weights := make([]int, 0, len(inStock))
+
+	for category := range inStock {
+		categories = append(categories, category)
+	}
+
+	slices.Sort(categories)
+
+	for _, category := range categories {
+		// every category has a chance, even without orders
+		weights = append(weights, max(categoryOrders[category], 0)+1)
+	}
+
+	input := models.OrderInput{BuyerName: getRandomName()}
+
+	itemsCount := 1
+	if rand.Float64() < secondItemProbability {
+		itemsCount = 2
+	}
+
+	for range itemsCount {
+		candidates := inStock[categories[weightedIndex(weights)]]
+		product := candidates[rand.Intn(len(candidates))]
+
+		if slices.ContainsFunc(input.Items, func(item models.OrderItemInput) bool { return item.ProductID == product.ID }) {
+			continue
+		}
+
+		input.Items = append(input.Items, models.OrderItemInput{
+			ProductID: product.ID,
+			Quantity:  1 + rand.Intn(min(product.WarehouseQuantity, maxRandomQuantity)),
+		})
+	}
+
+	return input, true
+}
+
+// weightedIndex returns a random index, each with the chance proportional to its weight.
+// Weights below 1 count as 1, so every index has a chance.
+func weightedIndex(weights []int) int {
+	var total int
+	for _, weight := range weights {
+		total += max(weight, 1)
+	}
+
+	pick := rand.Intn(total)
+
+	for i, weight := range weights {
+		weight = max(weight, 1)
+		if pick < weight {
+			return i
+		}
+
+		pick -= weight
+	}
+
+	return len(weights) - 1
+}
+
+// replaceDerived changes data of the product derived from feedbacks or orders on a copy, as edits do,
+// but keeps its UpdatedAt. Missing products are skipped. Must be called under productMutex.
+func (s *ProductService) replaceDerived(productID string, change func(product *models.Product)) {
+	product, has := s.productIndex[productID]
+	if !has {
+		return
+	}
+
+	updated := *product
+	change(&updated)
+
+	s.products[slices.Index(s.products, product)] = &updated
+	s.productIndex[updated.ID] = &updated
+
+	s.events.Publish(models.EventProductUpdated, updated.ToPageInfo())
+}
+
+// filterOrders returns copies of orders matching the filter. Must be called under productMutex.
+func (s *ProductService) filterOrders(filter models.OrderFilter) []listedOrder {
+	words := strings.Fields(strings.ToLower(filter.Search))
+
+	result := make([]listedOrder, 0, len(s.orders))
+
+	for i, order := range s.orders {
+		if matchesOrderFilter(order, filter, words) {
+			result = append(result, listedOrder{
+				Order:    order.Clone(),
+				sequence: uint64(i + 1),
+			})
+		}
+	}
+
+	return result
+}
+
+func matchesOrderFilter(order *models.Order, filter models.OrderFilter, words []string) bool {
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, order.Status) {
+		return false
+	}
+
+	if filter.ProductID != "" && !slices.ContainsFunc(order.Items, func(item models.OrderItem) bool {
+		return item.ProductID == filter.ProductID
+	}) {
+		return false
+	}
+
+	if !inPeriod(order.CreatedAt, filter.Since, filter.Until) {
+		return false
+	}
+
+	if len(words) == 0 {
+		return true
+	}
+
+	text := strings.ToLower(order.BuyerName)
+	for _, item := range order.Items {
+		text += " " + strings.ToLower(item.Name)
+	}
+
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// orderKey returns the position of the order in a list sorted by the filter field.
+func orderKey(filter models.OrderFilter) func(order listedOrder) sortKey {
+	return func(order listedOrder) sortKey {
+		key := sortKey{Sequence: order.sequence}
+
+		switch filter.Sort {
+		case models.SortByCreatedAt:
+			key.Number = float64(order.CreatedAt.UnixMicro())
+		case models.SortByTotal:
+			key.Number = order.Total
+		}
+
+		return key
+	}
+}
+
+func validateOrderStatusInput(input models.OrderStatusInput) error {
+	fields := make(map[string]string)
+
+	if !slices.Contains(models.OrderStatuses, input.Status) {
+		fields["status"] = "must be one of: " + strings.Join(models.OrderStatuses, ", ")
+	}
+
+	if utf8.RuneCountInString(input.Reason) > maxOrderReasonLength {
+		fields["reason"] = fmt.Sprintf("must be at most %d characters", maxOrderReasonLength)
+	}
+
+	if len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+// validateSnapshotOrders checks orders of a snapshot, they may refer to deleted products.
+func validateSnapshotOrders(orders []models.Order, fields map[string]string) {
+	if len(orders) > maxOrders {
+		fields["orders"] = fmt.Sprintf("must be at most %d", maxOrders)
+	}
+
+	ids := make(map[string]struct{}, len(orders))
+
+	for i, order := range orders {
+		prefix := fmt.Sprintf("orders[%d]", i)
+
+		if order.ID == "" {
+			fields[prefix+".id"] = "must not be empty"
+		} else if _, has := ids[order.ID]; has {
+			fields[prefix+".id"] = "must be unique"
+		}
+
+		ids[order.ID] = struct{}{}
+
+		if !slices.Contains(models.OrderStatuses, order.Status) {
+			fields[prefix+".status"] = "must be one of: " + strings.Join(models.OrderStatuses, ", ")
+		}
+
+		if len(order.Items) == 0 {
+			fields[prefix+".items"] = "must not be empty"
+		}
+
+		if len(order.History) == 0 || order.History[len(order.History)-1].Status != order.Status {
+			fields[prefix+".history"] = "must end with the order status"
+		}
+
+		if order.Status == models.OrderStatusRefunded && order.RefundedAt.IsZero() {
+			fields[prefix+".refundedAt"] = "must be set for a refunded order"
+		}
+
+		for j, item := range order.Items {
+			if item.Quantity <= 0 {
+				fields[fmt.Sprintf("%s.items[%d].quantity", prefix, j)] = "must be positive"
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"seller-pages/internal/models"
+)
+
+// sortOrder is the field and direction a list is sorted by. An empty field keeps the list order.
+type sortOrder struct {
+	Field      string
+	Descending bool
+}
+
+// sortKey is the position of an item in a sorted list: the sort field value, then the order
+// items were added in. It is also encoded into cursors, so short json names keep them compact.
+type sortKey struct {
+	Sort       string  `json:"s,omitempty"`
+	Descending bool    `json:"d,omitempty"`
+	Number     float64 `json:"v,omitempty"`
+	Text       string  `json:"t,omitempty"`
+	Sequence   uint64  `json:"q"`
+}
+
+func (o sortOrder) key(key sortKey) sortKey {
+	key.Sort = o.Field
+	key.Descending = o.Descending
+
+	return key
+}
+
+func compareKeys(a, b sortKey) int {
+	result := cmp.Or(cmp.Compare(a.Number, b.Number), strings.Compare(a.Text, b.Text))
+	if a.Descending {
+		result = -result
+	}
+
+	return cmp.Or(result, cmp.Compare(a.Sequence, b.Sequence))
+}
+
+// sortItems keeps the list order for equal values and when no sort field is set.
+func sortItems[T any](items []T, order sortOrder, keyOf func(T) sortKey) {
+	if order.Field == "" {
+		return
+	}
+
+	slices.SortFunc(items, func(a, b T) int {
+		return compareKeys(order.key(keyOf(a)), order.key(keyOf(b)))
+	})
+}
+
+// paginate returns a page of sorted items. In cursor mode the page starts right after
+// the cursor position, so inserts and deletes between requests never shift it.
+func paginate[T any](
+	items []T,
+	pageRequest models.PageRequest,
+	order sortOrder,
+	keyOf func(T) sortKey,
+) ([]T, models.Pagination, error) {
+	if pageRequest.PageSize <= 0 {
+		pageRequest.PageSize = models.DefaultPageSize
+	}
+
+	pagination := models.Pagination{
+		TotalPages: int(math.Ceil(float64(len(items)) / float64(pageRequest.PageSize))),
+	}
+
+	var paginationStart int
+
+	if pageRequest.Cursor != "" {
+		after, err := decodeCursor(pageRequest.Cursor, order)
+		if err != nil {
+			return nil, pagination, err
+		}
+
+		for paginationStart < len(items) && compareKeys(order.key(keyOf(items[paginationStart])), after) <= 0 {
+			paginationStart++
+		}
+	} else {
+		paginationStart = (max(pageRequest.Page, 1) - 1) * pageRequest.PageSize
+	}
+
+	if paginationStart >= len(items) {
+		return nil, pagination, nil
+	}
+
+	paginationEnd := min(paginationStart+pageRequest.PageSize, len(items))
+
+	if paginationEnd < len(items) {
+		cursor, err := encodeCursor(order.key(keyOf(items[paginationEnd-1])))
+		if err != nil {
+			return nil, pagination, err
+		}
+
+		pagination.NextCursor = cursor
+	}
+
+	return items[paginationStart:paginationEnd], pagination, nil
+}
+
+func encodeCursor(key sortKey) (string, error) {
+	buf, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("%w: can't encode cursor: %w", models.ErrInternalServer, err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func decodeCursor(cursor string, order sortOrder) (sortKey, error) {
+	var key sortKey
+
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return key, fmt.Errorf("%w: invalid cursor: %w", models.ErrBadRequest, err)
+	}
+
+	if err := json.Unmarshal(buf, &key); err != nil {
+		return key, fmt.Errorf("%w: invalid cursor: %w", models.ErrBadRequest, err)
+	}
+
+	if key.Sort != order.Field || key.Descending != order.Descending {
+		return key, fmt.Errorf("%w: cursor was issued for another sort order", models.ErrBadRequest)
+	}
+
+	return key, nil
+}
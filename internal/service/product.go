@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 
@@ -14,115 +19,346 @@ import (
 )
 
 const (
-	ProductsPerPage = 20
-	Tech            = "Электроника"
-	Beauty          = "Косметика"
-	Children        = "Детские товары"
-	Clothes         = "Одежда"
-	Household       = "Для дома"
-	Stationery      = "Канцелярия"
-)
+	maxProductNameLength = 200
 
-var errProductLoss = errors.New("product loss")
+	// generated products have refunds of at most a fifth of their orders
+	maxRandomRefundsShare = 5
+)
 
-var Categories = []string{
-	Tech,
-	Beauty,
-	Children,
-	Clothes,
-	Household,
-	Stationery,
-}
+var (
+	errProductLoss = errors.New("product loss")
+	articlePattern = regexp.MustCompile(`^[0-9]{10}$`)
+)
 
 type FeedbackProvider interface {
-	GetFeedbacks(product models.Product) models.FeedbackPageInfo
+	GetFeedbacks(product models.Product, filter models.FeedbackFilter) models.FeedbackPageInfo
+	FilterFeedbacks(productID string, filter models.FeedbackFilter) []*models.Feedback
+	Stats(productID string) models.FeedbackStats
+	ShopStats() models.FeedbackStats
+	ShopStatsUntil(until time.Time) models.FeedbackStats
 	AddFeedbacksToProduct(product models.Product)
+	AddRandomFeedback(product models.Product) *models.Feedback
+	AddRefundFeedback(product models.Product, buyerName, comment string) *models.Feedback
+	HasFeedback(productID, feedbackID string) bool
+	LinkRefund(feedbackID, refundID string, approved bool)
 	DeleteFeedbacks(product string)
+	AddReply(feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error)
+	UpdateReply(feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error)
+	DeleteReply(feedbackID string) error
+	MarkRead(input models.MarkReadInput) (models.FeedbackCounters, error)
+	Counters() models.FeedbackCounters
+	ExportTo(snapshot *models.SandboxSnapshot)
+	ImportFrom(snapshot models.SandboxSnapshot)
+	Count() int
 }
 
 type ProductService struct {
-	products        []models.Product
+	products        []*models.Product
 	productIndex    map[string]*models.Product
 	feedbackService FeedbackProvider
+	categories      *CategoryRegistry
+	clock           Clock
+	events          *EventStream
+	shopID          string
+
+	// sequences keep the order products were added in, cursors rely on it
+	// because positions in the slice shift on deletes.
+	sequences    map[string]uint64
+	lastSequence uint64
+
+	orders     []*models.Order
+	orderIndex map[string]int
+
+	refunds     []*models.Refund
+	refundIndex map[string]int
+
+	// stockMovements are stock journals of products, deleted with their products.
+	stockMovements map[string][]models.StockMovement
 
 	productMutex sync.RWMutex
 }
 
-func NewProductService(products []models.Product, feedbackService FeedbackProvider) *ProductService {
-	index := make(map[string]*models.Product, len(products))
+// NewProductService creates a sandbox with its own copy of products,
+// so changes never leak into the passed slice or other sandboxes.
+func NewProductService(
+	snapshot models.SandboxSnapshot,
+	feedbackService FeedbackProvider,
+	categories *CategoryRegistry,
+	clock Clock,
+	events *EventStream,
+	shopID string,
+) *ProductService {
+	result := &ProductService{
+		feedbackService: feedbackService,
+		categories:      categories,
+		clock:           clock,
+		events:          events,
+		shopID:          shopID,
+	}
+	result.setProducts(snapshot)
+	result.setOrders(snapshot.Orders)
+	result.setRefunds(snapshot.Refunds)
+	result.setStockMovements(snapshot.StockMovements)
+	result.applyFeedbackStats()
+
+	return result
+}
+
+// setProducts replaces the product list with copies of snapshot products. Products keep their stored
+// sequences, so cursors survive restores and restarts. Must be called under productMutex.
+func (s *ProductService) setProducts(snapshot models.SandboxSnapshot) {
+	products := snapshot.Products
+
+	s.products = make([]*models.Product, 0, len(products))
+	s.productIndex = make(map[string]*models.Product, len(products))
+	s.sequences = make(map[string]uint64, len(products))
+	s.lastSequence = snapshot.LastProductSequence
+
 	for i := range products {
-		index[products[i].ID] = &products[i]
+		product := products[i]
+		setRefundsPercent(&product)
+
+		s.insertProduct(&product, snapshot.ProductSequences[product.ID])
 	}
+}
 
-	return &ProductService{
-		products:        products,
-		productIndex:    index,
-		feedbackService: feedbackService,
+// seedRefundsCount turns the refunds percent of a seed product into the count refunds are kept in.
+func seedRefundsCount(product *models.Product) {
+	product.RefundsCount = int(math.Round(float64(product.OrdersCount) * product.RefundsPercent / 100))
+}
+
+// setRefundsPercent makes refunds the source of truth for the product refunds percent.
+func setRefundsPercent(product *models.Product) {
+	product.RefundsPercent = 0
+	if product.OrdersCount > 0 {
+		product.RefundsPercent = min(float64(product.RefundsCount)/float64(product.OrdersCount)*100, 100)
 	}
 }
 
-func (s *ProductService) GetProductsList(page int) ([]models.ProductPreview, int) {
+// applyFeedbackStats sets the rating of every product from its feedbacks.
+// Products are changed in place, so it must be called under productMutex right after setProducts.
+func (s *ProductService) applyFeedbackStats() {
+	for _, product := range s.products {
+		setFeedbackStats(product, s.feedbackService.Stats(product.ID))
+	}
+}
+
+// setFeedbackStats makes feedbacks the source of truth for the product rating.
+func setFeedbackStats(product *models.Product, stats models.FeedbackStats) {
+	product.Rating = stats.AverageRating
+}
+
+// appendProduct adds the product to the end of the list. Must be called under productMutex.
+func (s *ProductService) appendProduct(product *models.Product) {
+	s.insertProduct(product, s.lastSequence+1)
+}
+
+// insertProduct adds the product with the sequence to the end of the list. Must be called under productMutex.
+func (s *ProductService) insertProduct(product *models.Product, sequence uint64) {
+	s.products = append(s.products, product)
+	s.productIndex[product.ID] = product
+	s.sequences[product.ID] = sequence
+	s.lastSequence = max(s.lastSequence, sequence)
+}
+
+// Snapshot returns a deep copy of the sandbox state.
+func (s *ProductService) Snapshot() models.SandboxSnapshot {
 	s.productMutex.RLock()
-	productsAmount := len(s.products)
-	s.productMutex.RUnlock()
+	defer s.productMutex.RUnlock()
+
+	snapshot := models.SandboxSnapshot{
+		Products:            make([]models.Product, len(s.products)),
+		ProductSequences:    make(map[string]uint64, len(s.products)),
+		LastProductSequence: s.lastSequence,
+	}
+
+	for i, product := range s.products {
+		snapshot.Products[i] = *product
+		snapshot.ProductSequences[product.ID] = s.sequences[product.ID]
+	}
 
-	totalPages := int(math.Ceil(float64(productsAmount) / float64(ProductsPerPage)))
+	if len(s.orders) > 0 {
+		snapshot.Orders = make([]models.Order, len(s.orders))
+		for i, order := range s.orders {
+			snapshot.Orders[i] = order.Clone()
+		}
+	}
 
-	paginationStart := (page - 1) * ProductsPerPage
-	if paginationStart >= productsAmount {
-		return nil, totalPages
+	if len(s.refunds) > 0 {
+		snapshot.Refunds = make([]models.Refund, len(s.refunds))
+		for i, refund := range s.refunds {
+			snapshot.Refunds[i] = *refund
+		}
 	}
 
-	paginationEnd := paginationStart + ProductsPerPage
-	if paginationEnd > productsAmount {
-		paginationEnd = productsAmount
+	for _, product := range s.products {
+		snapshot.StockMovements = append(snapshot.StockMovements, s.stockMovements[product.ID]...)
 	}
 
-	listLen := paginationEnd - paginationStart
-	result := make([]models.ProductPreview, listLen)
-	productsToTransform := make([]models.Product, listLen)
+	s.feedbackService.ExportTo(&snapshot)
+
+	return snapshot
+}
+
+// CategoryCounts returns the number of products per category name.
+func (s *ProductService) CategoryCounts() map[string]int {
+	s.productMutex.RLock()
+	defer s.productMutex.RUnlock()
+
+	counts := make(map[string]int)
+	for _, product := range s.products {
+		counts[product.Category]++
+	}
+
+	return counts
+}
+
+// Counts returns the number of products and feedbacks in the sandbox.
+func (s *ProductService) Counts() (products, feedbacks int) {
+	s.productMutex.RLock()
+	products = len(s.products)
+	s.productMutex.RUnlock()
+
+	return products, s.feedbackService.Count()
+}
+
+// Restore replaces the whole sandbox state with a copy of the snapshot.
+func (s *ProductService) Restore(snapshot models.SandboxSnapshot) {
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	s.setProducts(snapshot)
+	s.setOrders(snapshot.Orders)
+	s.setRefunds(snapshot.Refunds)
+	s.setStockMovements(snapshot.StockMovements)
+	s.feedbackService.ImportFrom(snapshot)
+	s.applyFeedbackStats()
+}
 
+// GetProductsList returns a page of products matching the filter, in the filter order.
+func (s *ProductService) GetProductsList(
+	pageRequest models.PageRequest,
+	filter models.ProductFilter,
+) ([]models.ProductPreview, models.Pagination, error) {
 	s.productMutex.RLock()
-	_ = copy(productsToTransform, s.products[paginationStart:paginationEnd])
+	products := s.filterProducts(filter)
 	s.productMutex.RUnlock()
 
-	for i, product := range productsToTransform {
+	order := sortOrder{Field: filter.Sort, Descending: filter.Descending}
+	sortItems(products, order, productKey(filter))
+
+	page, pagination, err := paginate(products, pageRequest, order, productKey(filter))
+	if err != nil {
+		return nil, pagination, err
+	}
+
+	result := make([]models.ProductPreview, len(page))
+	for i, product := range page {
 		result[i] = product.ToPreview()
 	}
 
-	return result, totalPages
+	return result, pagination, nil
 }
 
-func (s *ProductService) GetProductsWithFeedbacks(page int) ([]models.FeedbackPageInfo, int) {
+// GetProductsWithFeedbacks returns a page of products with their feedbacks matching the filter.
+func (s *ProductService) GetProductsWithFeedbacks(
+	pageRequest models.PageRequest,
+	filter models.FeedbackFilter,
+) ([]models.FeedbackPageInfo, models.Pagination, error) {
 	s.productMutex.RLock()
-	productsAmount := len(s.products)
+	products := s.filterProducts(models.ProductFilter{})
 	s.productMutex.RUnlock()
 
-	totalPages := int(math.Ceil(float64(productsAmount) / float64(ProductsPerPage)))
-
-	paginationStart := (page - 1) * ProductsPerPage
-	if paginationStart >= productsAmount {
-		return nil, totalPages
+	page, pagination, err := paginate(products, pageRequest, sortOrder{}, productKey(models.ProductFilter{}))
+	if err != nil {
+		return nil, pagination, err
 	}
 
-	paginationEnd := paginationStart + ProductsPerPage
-	if paginationEnd > productsAmount {
-		paginationEnd = productsAmount
+	result := make([]models.FeedbackPageInfo, len(page))
+	for i, product := range page {
+		result[i] = s.feedbackService.GetFeedbacks(product.Product, filter)
 	}
 
-	listLen := paginationEnd - paginationStart
-	result := make([]models.FeedbackPageInfo, listLen)
-	productsToTransform := make([]models.Product, listLen)
+	return result, pagination, nil
+}
 
+// GetProductFeedbacks returns a page of the product feedbacks matching the filter.
+func (s *ProductService) GetProductFeedbacks(
+	productID string,
+	pageRequest models.PageRequest,
+	filter models.FeedbackFilter,
+) ([]*models.Feedback, models.Pagination, error) {
 	s.productMutex.RLock()
-	_ = copy(productsToTransform, s.products[paginationStart:paginationEnd])
+	_, has := s.productIndex[productID]
 	s.productMutex.RUnlock()
 
-	for i, product := range productsToTransform {
-		result[i] = s.feedbackService.GetFeedbacks(product)
+	if !has {
+		return nil, models.Pagination{}, fmt.Errorf("%w: product %s not found", models.ErrNotFound, productID)
+	}
+
+	feedbacks := s.feedbackService.FilterFeedbacks(productID, filter)
+
+	order := sortOrder{Field: filter.Sort, Descending: filter.Descending}
+	sortItems(feedbacks, order, feedbackKey(filter))
+
+	return paginate(feedbacks, pageRequest, order, feedbackKey(filter))
+}
+
+func (s *ProductService) GetFeedbackStats(productID string) (models.FeedbackStats, error) {
+	s.productMutex.RLock()
+	defer s.productMutex.RUnlock()
+
+	product, has := s.productIndex[productID]
+	if !has {
+		return models.FeedbackStats{}, fmt.Errorf("%w: product %s not found", models.ErrNotFound, productID)
+	}
+
+	stats := s.feedbackService.Stats(productID)
+	stats.RefundsPercent = product.RefundsPercent
+
+	return stats, nil
+}
+
+// GetShopFeedbackStats returns statistics of all feedbacks, the refunds percent is the share of refunded
+// orders of all products, the same way as for a single product.
+func (s *ProductService) GetShopFeedbackStats() models.FeedbackStats {
+	s.productMutex.RLock()
+	defer s.productMutex.RUnlock()
+
+	stats := s.feedbackService.ShopStats()
+
+	var orders, refunds int
+
+	for _, product := range s.products {
+		orders += product.OrdersCount
+		refunds += product.RefundsCount
 	}
 
-	return result, totalPages
+	if orders > 0 {
+		stats.RefundsPercent = min(float64(refunds)/float64(orders)*100, 100)
+	}
+
+	return stats
+}
+
+func (s *ProductService) MarkFeedbacksRead(input models.MarkReadInput) (models.FeedbackCounters, error) {
+	return s.feedbackService.MarkRead(input)
+}
+
+func (s *ProductService) GetFeedbackCounters() models.FeedbackCounters {
+	return s.feedbackService.Counters()
+}
+
+func (s *ProductService) AddFeedbackReply(feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error) {
+	return s.feedbackService.AddReply(feedbackID, input)
+}
+
+func (s *ProductService) UpdateFeedbackReply(feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error) {
+	return s.feedbackService.UpdateReply(feedbackID, input)
+}
+
+func (s *ProductService) DeleteFeedbackReply(feedbackID string) error {
+	return s.feedbackService.DeleteReply(feedbackID)
 }
 
 func (s *ProductService) GetProductByID(productID string) (models.ProductPageInfo, error) {
@@ -139,93 +375,243 @@ func (s *ProductService) GetProductByID(productID string) (models.ProductPageInf
 }
 
 func (s *ProductService) AddProduct() models.ProductPreview {
-	category := randomCategory()
+	category := s.categories.randomCategory()
+	now := s.clock.Now()
 
 	newProduct := models.Product{
 		ID:                uuid.NewString(),
-		Name:              randomName(category),
+		Name:              s.categories.randomName(category),
 		Article:           randomArticle(),
 		Category:          category,
 		Description:       randomDescription(),
-		ImageURL:          randomImageURL(category),
+		ImageURL:          s.categories.randomImageURL(category),
 		IsRemovable:       rand.Float64() < 0.9,
-		Rating:            randomRating(),
 		WarehouseQuantity: randomWarehouseQuantity(),
 		OrdersCount:       rand.Intn(1000),
-		RefundsPercent:    rand.Float64() * 100,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 
-	newProduct.Price, newProduct.OldPrice = getRandomPriceAndOldPrice(category)
+	newProduct.RefundsCount = rand.Intn(newProduct.OrdersCount/maxRandomRefundsShare + 1)
+	newProduct.Price, newProduct.OldPrice = s.categories.randomPriceAndOldPrice(category)
+	setRefundsPercent(&newProduct)
+
+	s.feedbackService.AddFeedbacksToProduct(newProduct)
+	setFeedbackStats(&newProduct, s.feedbackService.Stats(newProduct.ID))
 
 	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
 
-	s.productIndex[newProduct.ID] = &newProduct
-	s.products = append(s.products, newProduct)
+	s.appendProduct(&newProduct)
+	s.journalInitialStock(&newProduct)
+	s.events.Publish(models.EventProductCreated, newProduct.ToPreview())
+	s.publishBalance()
 
-	s.productMutex.Unlock()
+	return newProduct.ToPreview()
+}
 
-	s.feedbackService.AddFeedbacksToProduct(newProduct)
+// AddRandomFeedback posts a random feedback to a random product and refreshes the product rating.
+func (s *ProductService) AddRandomFeedback() (*models.Feedback, error) {
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
 
-	return newProduct.ToPreview()
+	if len(s.products) == 0 {
+		return nil, fmt.Errorf("%w: no products to post a feedback to", models.ErrNotFound)
+	}
+
+	product := s.products[rand.Intn(len(s.products))]
+	feedback := s.feedbackService.AddRandomFeedback(*product)
+
+	s.replaceDerived(product.ID, func(updated *models.Product) {
+		setFeedbackStats(updated, s.feedbackService.Stats(product.ID))
+	})
+	s.publishBalance()
+
+	return feedback, nil
 }
 
-func randomName(category string) string {
-	var names []string
-	switch category {
-	case Household:
-		names = []string{
-			"Лампа настольная",
-			"Стол рабочий",
-			"Подставка для книг",
-			"Декорации на стол",
-			"Коробки для хранения",
-		}
-	case Tech:
-		names = []string{
-			"Монитор для игр",
-			"Монитор FullHD",
-			"Клавиатура геймерская с подсветкой",
-			"Ноутбук",
-			"Колонки стационарные",
-		}
-	case Beauty:
-		names = []string{
-			"Крем увлажняющий",
-			"Крем омолаживающий",
-			"Набор кремов",
-			"Крем с фруктовым ароматом",
-			"Крем для рук",
-			"Крем для тела",
-		}
-	case Children:
-		names = []string{
-			"Комбнезон",
-			"Одежда для выписки",
-			"Белье детское",
-			"Красивый комплект",
-		}
-	case Clothes:
-		names = []string{
-			"Футболка новой коллекции",
-			"Классная кофта",
-			"Идельные штаны",
-			"Комплект на каждый день",
-			"Комфортный комплект одежды",
-		}
-	case Stationery:
-		names = []string{
-			"Концелярский набор для школы",
-			"Набор первоклассника",
-			"Необходимые товары для офиса",
-			"Ручки и карандаши с пеналом",
-		}
-	default:
-		names = []string{
-			"Товар что надо",
-		}
+func (s *ProductService) CreateProduct(input models.NewProductInput) (models.ProductPreview, error) {
+	if err := validateNewProductInput(input, s.categories); err != nil {
+		return models.ProductPreview{}, err
+	}
+
+	now := s.clock.Now()
+
+	newProduct := models.Product{
+		ID:                uuid.NewString(),
+		Name:              strings.TrimSpace(input.Name),
+		Article:           input.Article,
+		Category:          input.Category,
+		Description:       strings.TrimSpace(input.Description),
+		ImageURL:          input.ImageURL,
+		IsRemovable:       true,
+		OldPrice:          input.OldPrice,
+		Price:             input.Price,
+		WarehouseQuantity: input.WarehouseQuantity,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	if newProduct.ImageURL == "" {
+		newProduct.ImageURL = s.categories.randomImageURL(newProduct.Category)
+	}
+
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	s.appendProduct(&newProduct)
+	s.journalInitialStock(&newProduct)
+	s.events.Publish(models.EventProductCreated, newProduct.ToPreview())
+	s.publishBalance()
+
+	return newProduct.ToPreview(), nil
+}
+
+// journalInitialStock records the stock of a new product as its first receipt. Must be called under productMutex.
+func (s *ProductService) journalInitialStock(product *models.Product) {
+	if product.WarehouseQuantity > 0 {
+		s.journalStock(product, models.StockMovement{
+			Type:     models.StockMovementReceipt,
+			Quantity: product.WarehouseQuantity,
+			Reason:   initialStockReason,
+		})
+	}
+}
+
+// UpdateProduct fully replaces editable fields of the product.
+func (s *ProductService) UpdateProduct(productID string, input models.ProductInput) (models.ProductPageInfo, error) {
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	product, err := s.getEditableProduct(productID)
+	if err != nil {
+		return models.ProductPageInfo{}, err
+	}
+
+	return s.replaceProduct(product, input)
+}
+
+// PatchProduct applies a JSON merge patch (RFC 7386) to editable fields of the product.
+func (s *ProductService) PatchProduct(productID string, patch map[string]any) (models.ProductPageInfo, error) {
+	if err := validatePatchFields[models.ProductInput](patch); err != nil {
+		return models.ProductPageInfo{}, err
+	}
+
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	product, err := s.getEditableProduct(productID)
+	if err != nil {
+		return models.ProductPageInfo{}, err
+	}
+
+	input, err := mergePatch(product.ToInput(), patch)
+	if err != nil {
+		return models.ProductPageInfo{}, fmt.Errorf("%w: can't apply patch: %w", models.ErrBadRequest, err)
+	}
+
+	return s.replaceProduct(product, input)
+}
+
+func (s *ProductService) getEditableProduct(productID string) (*models.Product, error) {
+	product, has := s.productIndex[productID]
+	if !has {
+		return nil, fmt.Errorf("%w: product %s not found", models.ErrNotFound, productID)
+	}
+
+	if !product.IsRemovable {
+		return nil, fmt.Errorf("%w: product is not editable", models.ErrForbidden)
+	}
+
+	return product, nil
+}
+
+// replaceProduct stores an updated copy of the product instead of mutating it in place,
+// so previously returned values are never changed. Must be called under productMutex.
+func (s *ProductService) replaceProduct(product *models.Product, input models.ProductInput) (models.ProductPageInfo, error) {
+	if err := validateProductInput(input, s.categories); err != nil {
+		return models.ProductPageInfo{}, err
 	}
 
-	return names[rand.Intn(len(names))]
+	updated := *product
+	updated.Name = strings.TrimSpace(input.Name)
+	updated.Article = input.Article
+	updated.Category = input.Category
+	updated.Description = strings.TrimSpace(input.Description)
+	updated.ImageURL = input.ImageURL
+	updated.OldPrice = input.OldPrice
+	updated.Price = input.Price
+	updated.UpdatedAt = s.clock.Now()
+
+	if updated.ImageURL == "" {
+		updated.ImageURL = s.categories.randomImageURL(updated.Category)
+	}
+
+	index := slices.Index(s.products, product)
+	if index < 0 {
+		return models.ProductPageInfo{}, fmt.Errorf("%w: product not found in list", errProductLoss)
+	}
+
+	s.products[index] = &updated
+	s.productIndex[updated.ID] = &updated
+
+	s.events.Publish(models.EventProductUpdated, updated.ToPageInfo())
+	s.publishBalance()
+
+	return updated.ToPageInfo(), nil
+}
+
+func validateProductInput(input models.ProductInput, categories *CategoryRegistry) error {
+	fields := make(map[string]string)
+
+	if strings.TrimSpace(input.Name) == "" {
+		fields["name"] = "must not be empty"
+	} else if utf8.RuneCountInString(input.Name) > maxProductNameLength {
+		fields["name"] = fmt.Sprintf("must be at most %d characters", maxProductNameLength)
+	}
+
+	if !articlePattern.MatchString(input.Article) {
+		fields["article"] = "must consist of exactly 10 digits"
+	}
+
+	if !categories.IsAssignable(input.Category) {
+		fields["category"] = "must be one of: " + strings.Join(categories.AssignableNames(), ", ")
+	}
+
+	if input.Price <= 0 {
+		fields["price"] = "must be positive"
+	}
+
+	if input.OldPrice < 0 {
+		fields["oldPrice"] = "must not be negative"
+	} else if input.OldPrice != 0 && input.OldPrice < input.Price {
+		fields["oldPrice"] = "must be greater than or equal to price"
+	}
+
+	if len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+func validateNewProductInput(input models.NewProductInput, categories *CategoryRegistry) error {
+	fields := make(map[string]string)
+
+	var productErr *models.ValidationError
+	if errors.As(validateProductInput(input.ProductInput, categories), &productErr) {
+		fields = productErr.Fields
+	}
+
+	if input.WarehouseQuantity < 0 {
+		fields["warehouseQuantity"] = "must not be negative"
+	}
+
+	if len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+
+	return nil
 }
 
 func (s *ProductService) DeleteProductByID(productID string) error {
@@ -244,10 +630,15 @@ func (s *ProductService) DeleteProductByID(productID string) error {
 	s.feedbackService.DeleteFeedbacks(productID)
 
 	delete(s.productIndex, productID)
-	for i, product := range s.products {
-		if product.ID == productID {
+	delete(s.sequences, productID)
+	delete(s.stockMovements, productID)
+	for i := range s.products {
+		if s.products[i] == product {
 			s.products = append(s.products[:i], s.products[i+1:]...)
 
+			s.events.Publish(models.EventProductDeleted, models.ProductDeletedEvent{ID: productID})
+			s.publishBalance()
+
 			return nil
 		}
 	}
@@ -259,14 +650,6 @@ func randomWarehouseQuantity() int {
 	return rand.Intn(1000)
 }
 
-func randomRating() float64 {
-	return rand.Float64() * 5
-}
-
-func randomCategory() string {
-	return Categories[rand.Intn(len(Categories))]
-}
-
 func randomArticle() string {
 	articleMin := 1000000000
 	articleMax := 9999999999
@@ -288,97 +671,3 @@ func randomDescription() string {
 
 	return description
 }
-
-func randomImageURL(category string) string {
-	var images []string
-	switch category {
-	case Household:
-		images = []string{
-			"https://basket-15.wbbasket.ru/vol2271/part227133/227133697/images/big/8.webp",
-			"https://basket-15.wbbasket.ru/vol2271/part227133/227133697/images/big/9.webp",
-			"https://basket-15.wbbasket.ru/vol2271/part227133/227133697/images/big/10.webp",
-			"https://basket-15.wbbasket.ru/vol2271/part227133/227133697/images/big/10.webp",
-		}
-	case Tech:
-		images = []string{
-			"https://basket-15.wbbasket.ru/vol2405/part240554/240554144/images/big/3.webp",
-			"https://basket-15.wbbasket.ru/vol2405/part240554/240554144/images/big/4.webp",
-			"https://basket-26.wbbasket.ru/vol4665/part466522/466522013/images/big/1.webp",
-		}
-	case Beauty:
-		images = []string{
-			"https://basket-10.wbbasket.ru/vol1511/part151190/151190621/images/big/1.webp",
-			"https://basket-11.wbbasket.ru/vol1625/part162546/162546677/images/big/2.webp",
-			"https://basket-19.wbbasket.ru/vol3178/part317854/317854683/images/big/1.webp",
-			"https://basket-19.wbbasket.ru/vol3178/part317854/317854683/images/big/3.webp",
-			"https://basket-16.wbbasket.ru/vol2484/part248439/248439960/images/big/1.webp",
-			"https://basket-17.wbbasket.ru/vol2679/part267903/267903164/images/big/1.webp",
-		}
-	case Children:
-		images = []string{
-			"https://basket-17.wbbasket.ru/vol2699/part269922/269922591/images/big/2.webp",
-			"https://basket-19.wbbasket.ru/vol3153/part315358/315358478/images/big/6.webp",
-			"https://basket-18.wbbasket.ru/vol3047/part304775/304775028/images/big/2.webp",
-			"https://basket-18.wbbasket.ru/vol3047/part304775/304775028/images/big/3.webp",
-			"https://basket-26.wbbasket.ru/vol4777/part477756/477756673/images/big/1.webp",
-		}
-	case Clothes:
-		images = []string{
-			"https://basket-02.wbbasket.ru/vol255/part25539/25539349/images/big/2.webp",
-			"https://basket-10.wbbasket.ru/vol1314/part131439/131439248/images/big/3.webp",
-			"https://basket-15.wbbasket.ru/vol2237/part223714/223714031/images/big/1.webp",
-			"https://basket-05.wbbasket.ru/vol963/part96316/96316155/images/big/3.webp",
-			"https://basket-26.wbbasket.ru/vol4806/part480669/480669352/images/big/2.webp",
-		}
-	case Stationery:
-		images = []string{
-			"https://basket-16.wbbasket.ru/vol2581/part258124/258124707/images/big/1.webp",
-			"https://basket-12.wbbasket.ru/vol1712/part171222/171222754/images/big/1.webp",
-			"https://basket-21.wbbasket.ru/vol3533/part353384/353384700/images/big/1.webp",
-			"https://basket-25.wbbasket.ru/vol4458/part445898/445898947/images/big/1.webp",
-			"https://basket-16.wbbasket.ru/vol2501/part250150/250150130/images/big/1.webp",
-			"https://basket-26.wbbasket.ru/vol4583/part458372/458372626/images/big/1.webp",
-		}
-	default:
-		images = []string{
-			"https://basket-16.wbbasket.ru/vol2574/part257400/257400077/images/big/11.webp",
-			"https://basket-22.wbbasket.ru/vol3704/part370494/370494201/images/big/2.webp",
-			"https://basket-16.wbbasket.ru/vol2619/part261968/261968456/images/big/1.webp",
-			"https://basket-09.wbbasket.ru/vol1207/part120753/120753915/images/big/1.webp",
-		}
-	}
-
-	return images[rand.Intn(len(images))]
-}
-
-func getRandomPriceAndOldPrice(category string) (price, oldPrice float64) {
-	var minPrice, maxPrice float64
-	switch category {
-	case Household:
-		fallthrough
-	case Tech:
-		minPrice = 5000
-		maxPrice = 20000
-	case Beauty:
-		minPrice = 50
-		maxPrice = 1000
-	case Children:
-		minPrice = 100
-		maxPrice = 10000
-	case Clothes:
-		minPrice = 1000
-		maxPrice = 10000
-	case Stationery:
-		minPrice = 10
-		maxPrice = 500
-	}
-
-	price = rand.Float64()*(maxPrice-minPrice) + minPrice
-
-	const probabilityOfEmptyOldPrice = 0.7
-	if rand.Float64() < probabilityOfEmptyOldPrice {
-		oldPrice = price + rand.Float64()*(maxPrice-price)
-	}
-
-	return
-}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"seller-pages/internal/models"
+)
+
+// listedProduct is a product copy with its position in the sandbox list.
+type listedProduct struct {
+	models.Product
+
+	sequence uint64
+}
+
+// filterProducts returns copies of products matching the filter. Must be called under productMutex.
+func (s *ProductService) filterProducts(filter models.ProductFilter) []listedProduct {
+	words := strings.Fields(strings.ToLower(filter.Search))
+
+	result := make([]listedProduct, 0, len(s.products))
+
+	for _, product := range s.products {
+		if matchesFilter(product, filter, words) {
+			result = append(result, listedProduct{
+				Product:  *product,
+				sequence: s.sequences[product.ID],
+			})
+		}
+	}
+
+	return result
+}
+
+func matchesFilter(product *models.Product, filter models.ProductFilter, words []string) bool {
+	if len(filter.Categories) > 0 && !slices.Contains(filter.Categories, product.Category) {
+		return false
+	}
+
+	if filter.MinPrice != nil && product.Price < *filter.MinPrice {
+		return false
+	}
+
+	if filter.MaxPrice != nil && product.Price > *filter.MaxPrice {
+		return false
+	}
+
+	if filter.HasDiscount != nil && (product.OldPrice > 0) != *filter.HasDiscount {
+		return false
+	}
+
+	if filter.Removable != nil && product.IsRemovable != *filter.Removable {
+		return false
+	}
+
+	if !inPeriod(product.CreatedAt, filter.Since, filter.Until) {
+		return false
+	}
+
+	if len(words) == 0 {
+		return true
+	}
+
+	text := strings.ToLower(product.Name + " " + product.Description + " " + product.Article)
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// productKey returns the position of the product in a list sorted by the filter field.
+func productKey(filter models.ProductFilter) func(product listedProduct) sortKey {
+	return func(product listedProduct) sortKey {
+		key := sortKey{Sequence: product.sequence}
+
+		switch filter.Sort {
+		case models.SortByPrice:
+			key.Number = product.Price
+		case models.SortByRating:
+			key.Number = product.Rating
+		case models.SortByOrdersCount:
+			key.Number = float64(product.OrdersCount)
+		case models.SortByName:
+			key.Text = strings.ToLower(product.Name)
+		case models.SortByCreatedAt:
+			key.Number = float64(product.CreatedAt.UnixMicro())
+		}
+
+		return key
+	}
+}
+
+// inPeriod reports whether t is in [since, until). Nil bounds are not applied.
+func inPeriod(t time.Time, since, until *time.Time) bool {
+	if since != nil && t.Before(*since) {
+		return false
+	}
+
+	return until == nil || t.Before(*until)
+}
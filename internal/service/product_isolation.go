@@ -2,73 +2,933 @@ package service
 
 import (
 	"context"
-	"seller-pages/internal/models"
+	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
+
+	"seller-pages/internal/config"
+	"seller-pages/internal/models"
 )
 
 type PersonalProducts interface {
-	GetProductsList(page int) ([]models.ProductPreview, int)
+	GetProductsList(pageRequest models.PageRequest, filter models.ProductFilter) ([]models.ProductPreview, models.Pagination, error)
 	GetProductByID(id string) (models.ProductPageInfo, error)
 	AddProduct() models.ProductPreview
+	CreateProduct(input models.NewProductInput) (models.ProductPreview, error)
+	UpdateProduct(productID string, input models.ProductInput) (models.ProductPageInfo, error)
+	PatchProduct(productID string, patch map[string]any) (models.ProductPageInfo, error)
 	DeleteProductByID(productID string) error
-	GetProductsWithFeedbacks(page int) ([]models.FeedbackPageInfo, int)
+	GetProductsWithFeedbacks(
+		pageRequest models.PageRequest,
+		filter models.FeedbackFilter,
+	) ([]models.FeedbackPageInfo, models.Pagination, error)
+	GetProductFeedbacks(
+		productID string,
+		pageRequest models.PageRequest,
+		filter models.FeedbackFilter,
+	) ([]*models.Feedback, models.Pagination, error)
+	MarkFeedbacksRead(input models.MarkReadInput) (models.FeedbackCounters, error)
+	GetFeedbackCounters() models.FeedbackCounters
+	AddFeedbackReply(feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error)
+	UpdateFeedbackReply(feedbackID string, input models.FeedbackReplyInput) (models.FeedbackReply, error)
+	DeleteFeedbackReply(feedbackID string) error
+	GetFeedbackStats(productID string) (models.FeedbackStats, error)
+	GetShopFeedbackStats() models.FeedbackStats
+	BalanceInfo(query models.ChartQuery) (models.BalanceInfo, error)
+	GetOrders(pageRequest models.PageRequest, filter models.OrderFilter) ([]models.Order, models.Pagination, error)
+	GetOrderByID(orderID string) (models.Order, error)
+	ChangeOrderStatus(orderID string, input models.OrderStatusInput) (models.Order, error)
+	AddRandomOrder() (models.Order, error)
+	GetRefunds(pageRequest models.PageRequest, filter models.RefundFilter) ([]models.Refund, models.Pagination, error)
+	GetRefundByID(refundID string) (models.Refund, error)
+	RequestRefund(input models.RefundInput) (models.Refund, error)
+	ResolveRefund(refundID string, input models.RefundResolutionInput) (models.Refund, error)
+	AdjustStock(productID string, input models.StockAdjustmentInput) (models.StockMovement, error)
+	GetStockMovements(
+		productID string,
+		pageRequest models.PageRequest,
+		filter models.StockMovementFilter,
+	) ([]models.StockMovement, models.Pagination, error)
+	SetLowStockThreshold(productID string, input models.LowStockThresholdInput) (models.ProductPageInfo, error)
+	GetLowStockProducts() []models.ProductPageInfo
+	CategoryCounts() map[string]int
+	Snapshot() models.SandboxSnapshot
+	Restore(snapshot models.SandboxSnapshot)
+}
+
+// SandboxStorage persists sandboxes between restarts.
+type SandboxStorage interface {
+	Save(nickname string, snapshot models.SandboxSnapshot) error
+	Load(nickname string) (models.SandboxSnapshot, error)
+	List() ([]string, error)
 }
+
 type ProductIsolationService struct {
-	services map[string]*ProductService
+	services map[string]*sandbox
+	// evicting are sandboxes removed from services which are still being saved.
+	evicting map[string]*sandbox
+	// evictions counts finished evictions, a sandbox read from the storage before one of them may be stale.
+	evictions uint64
+	// evictedInfo keeps stats of saved sandboxes which are not loaded, so listing doesn't read the storage.
+	evictedInfo       map[string]models.SandboxInfo
+	evictedInfoLoaded bool
 
-	initProducts     []models.Product
-	feedbacksService *FeedbackService
-	logger           *zap.SugaredLogger
+	initProducts  []models.Product
+	initFeedbacks *FeedbackService
+	categories    *CategoryRegistry
+	clock         Clock
+	events        *EventBus
+	storage       SandboxStorage
+	limits        config.SandboxOpts
+	logger        *zap.SugaredLogger
 
 	mu sync.RWMutex
 }
 
-func NewProductIsolationService(initProducts []models.Product, feedbackService *FeedbackService, logger *zap.SugaredLogger) *ProductIsolationService {
+// NewProductIsolationService creates per-nickname sandboxes seeded from initial data.
+// If storage is nil, sandboxes live only in memory and evicted ones are lost.
+func NewProductIsolationService(
+	initProducts []models.Product,
+	feedbackService *FeedbackService,
+	categories *CategoryRegistry,
+	clock Clock,
+	events *EventBus,
+	storage SandboxStorage,
+	limits config.SandboxOpts,
+	logger *zap.SugaredLogger,
+) *ProductIsolationService {
+	initProducts = slices.Clone(initProducts)
+	for i := range initProducts {
+		seedRefundsCount(&initProducts[i])
+	}
+
+	feedbackService.mx.Lock()
+	fillTimestamps(models.SandboxSnapshot{
+		Products:            initProducts,
+		Feedbacks:           feedbackService.feedbacks,
+		FeedbacksPerProduct: feedbackService.feedbacksPerProduct,
+	}, clock.Now())
+	feedbackService.mx.Unlock()
+
 	return &ProductIsolationService{
-		services:         make(map[string]*ProductService),
-		initProducts:     initProducts,
-		feedbacksService: feedbackService,
-		logger:           logger,
-		mu:               sync.RWMutex{},
+		services:      make(map[string]*sandbox),
+		evicting:      make(map[string]*sandbox),
+		evictedInfo:   make(map[string]models.SandboxInfo),
+		initProducts:  initProducts,
+		initFeedbacks: feedbackService,
+		categories:    categories,
+		clock:         clock,
+		events:        events,
+		storage:       storage,
+		limits:        limits,
+		logger:        logger,
+		mu:            sync.RWMutex{},
 	}
 }
 
-func (s *ProductIsolationService) GetProductsList(ctx context.Context, page int) ([]models.ProductPreview, int) {
-	return s.getProductService(ctx).GetProductsList(page)
+// Restore loads the most recently active saved sandboxes from the storage, up to the sandboxes limit.
+// The rest are loaded on first access.
+func (s *ProductIsolationService) Restore() error {
+	if s.storage == nil {
+		return nil
+	}
+
+	nicknames, err := s.storage.List()
+	if err != nil {
+		return fmt.Errorf("can't list saved sandboxes: %w", err)
+	}
+
+	restored := make([]*sandbox, 0, len(nicknames))
+
+	for _, nickname := range nicknames {
+		snapshot, err := s.storage.Load(nickname)
+		if err != nil {
+			s.logger.Errorf("can't load sandbox with nickname %s: %v", nickname, err)
+
+			continue
+		}
+
+		restored = append(restored, s.restoreSandbox(nickname, snapshot))
+	}
+
+	slices.SortFunc(restored, func(a, b *sandbox) int {
+		return b.lastActivityAt().Compare(a.lastActivityAt())
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// sandboxes above the limit stay in the storage, only their stats are kept
+	for _, existing := range restored {
+		if s.limits.MaxCount > 0 && len(s.services) >= s.limits.MaxCount {
+			info := existing.info()
+			info.IsLoaded = false
+			s.evictedInfo[existing.nickname] = info
+			s.events.Release(existing.nickname)
+
+			continue
+		}
+
+		s.services[existing.nickname] = existing
+	}
+
+	s.evictedInfoLoaded = true
+
+	s.logger.Infof("%d of %d saved sandboxes restored", len(s.services), len(nicknames))
+
+	return nil
+}
+
+func (s *ProductIsolationService) GetProductsList(
+	ctx context.Context,
+	pageRequest models.PageRequest,
+	filter models.ProductFilter,
+) ([]models.ProductPreview, models.Pagination, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetProductsList(pageRequest, filter)
 }
 func (s *ProductIsolationService) GetProductByID(ctx context.Context, id string) (models.ProductPageInfo, error) {
-	return s.getProductService(ctx).GetProductByID(id)
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetProductByID(id)
 }
 func (s *ProductIsolationService) AddProduct(ctx context.Context) models.ProductPreview {
-	return s.getProductService(ctx).AddProduct()
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+	defer sandbox.markUnsaved()
+
+	return sandbox.service.AddProduct()
+}
+func (s *ProductIsolationService) CreateProduct(ctx context.Context, input models.NewProductInput) (models.ProductPreview, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.CreateProduct(input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) UpdateProduct(ctx context.Context, productID string, input models.ProductInput) (models.ProductPageInfo, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.UpdateProduct(productID, input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) PatchProduct(ctx context.Context, productID string, patch map[string]any) (models.ProductPageInfo, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.PatchProduct(productID, patch)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
 }
 func (s *ProductIsolationService) DeleteProductByID(ctx context.Context, productID string) error {
-	return s.getProductService(ctx).DeleteProductByID(productID)
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	err := sandbox.service.DeleteProductByID(productID)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return err
 }
-func (s *ProductIsolationService) GetProductsWithFeedbacks(ctx context.Context, page int) ([]models.FeedbackPageInfo, int) {
-	return s.getProductService(ctx).GetProductsWithFeedbacks(page)
+func (s *ProductIsolationService) AdjustStock(
+	ctx context.Context,
+	productID string,
+	input models.StockAdjustmentInput,
+) (models.StockMovement, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.AdjustStock(productID, input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
 }
+func (s *ProductIsolationService) GetStockMovements(
+	ctx context.Context,
+	productID string,
+	pageRequest models.PageRequest,
+	filter models.StockMovementFilter,
+) ([]models.StockMovement, models.Pagination, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
 
-func (s *ProductIsolationService) getProductService(ctx context.Context) *ProductService {
-	nickname := models.ClaimsFromContext(ctx).Nickname
+	return sandbox.service.GetStockMovements(productID, pageRequest, filter)
+}
+func (s *ProductIsolationService) SetLowStockThreshold(
+	ctx context.Context,
+	productID string,
+	input models.LowStockThresholdInput,
+) (models.ProductPageInfo, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.SetLowStockThreshold(productID, input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) GetLowStockProducts(ctx context.Context) []models.ProductPageInfo {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetLowStockProducts()
+}
+func (s *ProductIsolationService) GetProductsWithFeedbacks(
+	ctx context.Context,
+	pageRequest models.PageRequest,
+	filter models.FeedbackFilter,
+) ([]models.FeedbackPageInfo, models.Pagination, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetProductsWithFeedbacks(pageRequest, filter)
+}
+
+func (s *ProductIsolationService) GetProductFeedbacks(
+	ctx context.Context,
+	productID string,
+	pageRequest models.PageRequest,
+	filter models.FeedbackFilter,
+) ([]*models.Feedback, models.Pagination, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetProductFeedbacks(productID, pageRequest, filter)
+}
+func (s *ProductIsolationService) GetFeedbackStats(ctx context.Context, productID string) (models.FeedbackStats, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetFeedbackStats(productID)
+}
+func (s *ProductIsolationService) GetShopFeedbackStats(ctx context.Context) models.FeedbackStats {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetShopFeedbackStats()
+}
+func (s *ProductIsolationService) MarkFeedbacksRead(
+	ctx context.Context,
+	input models.MarkReadInput,
+) (models.FeedbackCounters, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.MarkFeedbacksRead(input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) GetFeedbackCounters(ctx context.Context) models.FeedbackCounters {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetFeedbackCounters()
+}
+func (s *ProductIsolationService) AddFeedbackReply(
+	ctx context.Context,
+	feedbackID string,
+	input models.FeedbackReplyInput,
+) (models.FeedbackReply, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.AddFeedbackReply(feedbackID, input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) UpdateFeedbackReply(
+	ctx context.Context,
+	feedbackID string,
+	input models.FeedbackReplyInput,
+) (models.FeedbackReply, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.UpdateFeedbackReply(feedbackID, input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) DeleteFeedbackReply(ctx context.Context, feedbackID string) error {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	err := sandbox.service.DeleteFeedbackReply(feedbackID)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return err
+}
+
+// GetBalanceInfo returns the seller balance computed from the caller's sandbox.
+func (s *ProductIsolationService) GetBalanceInfo(ctx context.Context, query models.ChartQuery) (models.BalanceInfo, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.BalanceInfo(query)
+}
+
+func (s *ProductIsolationService) GetOrders(
+	ctx context.Context,
+	pageRequest models.PageRequest,
+	filter models.OrderFilter,
+) ([]models.Order, models.Pagination, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetOrders(pageRequest, filter)
+}
+func (s *ProductIsolationService) GetOrderByID(ctx context.Context, orderID string) (models.Order, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetOrderByID(orderID)
+}
+func (s *ProductIsolationService) AddRandomOrder(ctx context.Context) (models.Order, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.AddRandomOrder()
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) ChangeOrderStatus(
+	ctx context.Context,
+	orderID string,
+	input models.OrderStatusInput,
+) (models.Order, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.ChangeOrderStatus(orderID, input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) GetRefunds(
+	ctx context.Context,
+	pageRequest models.PageRequest,
+	filter models.RefundFilter,
+) ([]models.Refund, models.Pagination, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetRefunds(pageRequest, filter)
+}
+func (s *ProductIsolationService) GetRefundByID(ctx context.Context, refundID string) (models.Refund, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service.GetRefundByID(refundID)
+}
+func (s *ProductIsolationService) RequestRefund(ctx context.Context, input models.RefundInput) (models.Refund, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.RequestRefund(input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+func (s *ProductIsolationService) ResolveRefund(
+	ctx context.Context,
+	refundID string,
+	input models.RefundResolutionInput,
+) (models.Refund, error) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	result, err := sandbox.service.ResolveRefund(refundID, input)
+	if err == nil {
+		sandbox.markUnsaved()
+	}
+
+	return result, err
+}
+
+// GetCategories returns the categories tree with product counts of the caller's sandbox.
+func (s *ProductIsolationService) GetCategories(ctx context.Context) []models.CategoryInfo {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return s.categories.Tree(sandbox.service.CategoryCounts())
+}
+
+// ResetSandbox rebuilds the caller's sandbox from the initial data.
+func (s *ProductIsolationService) ResetSandbox(ctx context.Context) {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	sandbox.service.Restore(s.seedSnapshot())
+	sandbox.markUnsaved()
+	s.events.Stream(sandbox.nickname).Publish(models.EventResync, nil)
+
+	s.logger.Infof("Sandbox with nickname %s reset", sandbox.nickname)
+}
+
+func (s *ProductIsolationService) GetSandboxSnapshot(ctx context.Context) models.SandboxSnapshot {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.snapshot()
+}
+
+// RestoreSandbox replaces the caller's sandbox with the snapshot.
+func (s *ProductIsolationService) RestoreSandbox(ctx context.Context, snapshot models.SandboxSnapshot) error {
+	if err := validateSnapshot(snapshot, s.categories); err != nil {
+		return err
+	}
+
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	fillTimestamps(snapshot, s.clock.Now())
+	sandbox.service.Restore(snapshot)
+	sandbox.markUnsaved()
+	s.events.Stream(sandbox.nickname).Publish(models.EventResync, nil)
+
+	s.logger.Infof("Sandbox with nickname %s restored from snapshot", sandbox.nickname)
+
+	return nil
+}
+
+// ListSandboxes returns stats of all sandboxes, most recently active first. Only for teachers.
+func (s *ProductIsolationService) ListSandboxes(ctx context.Context) ([]models.SandboxInfo, error) {
+	claims := models.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil, fmt.Errorf("%w: claims are empty", models.ErrUnauthorized)
+	}
+
+	if !claims.IsTeacher {
+		return nil, fmt.Errorf("%w: sandboxes list is available only for teachers", models.ErrForbidden)
+	}
+
+	s.loadEvictedInfo()
 
 	s.mu.RLock()
-	service, has := s.services[nickname]
+	sandboxes := make([]*sandbox, 0, len(s.services)+len(s.evicting))
+	for _, existing := range s.services {
+		sandboxes = append(sandboxes, existing)
+	}
+	for _, existing := range s.evicting {
+		sandboxes = append(sandboxes, existing)
+	}
+
+	result := make([]models.SandboxInfo, 0, len(sandboxes)+len(s.evictedInfo))
+	for _, info := range s.evictedInfo {
+		result = append(result, info)
+	}
 	s.mu.RUnlock()
 
-	if has {
-		return service
+	for _, existing := range sandboxes {
+		result = append(result, existing.info())
 	}
 
-	newService := NewProductService(s.initProducts, s.feedbacksService)
+	slices.SortFunc(result, func(a, b models.SandboxInfo) int {
+		return b.LastActivityAt.Compare(a.LastActivityAt)
+	})
+
+	return result, nil
+}
+
+// HasSandbox reports whether the nickname has a loaded or saved sandbox. It doesn't load the sandbox.
+func (s *ProductIsolationService) HasSandbox(nickname string) bool {
+	s.loadEvictedInfo()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, isLoaded := s.services[nickname]
+	_, isEvicting := s.evicting[nickname]
+	_, isEvicted := s.evictedInfo[nickname]
+
+	return isLoaded || isEvicting || isEvicted
+}
+
+// loadEvictedInfo reads stats of saved sandboxes once, later evictions keep them up to date.
+// Sandboxes which are loaded or already known are skipped.
+func (s *ProductIsolationService) loadEvictedInfo() {
+	s.mu.RLock()
+	loaded := s.evictedInfoLoaded
+	s.mu.RUnlock()
+
+	if loaded || s.storage == nil {
+		return
+	}
+
+	nicknames, err := s.storage.List()
+	if err != nil {
+		s.logger.Errorf("can't list saved sandboxes: %v", err)
+
+		return
+	}
+
+	saved := make(map[string]models.SandboxInfo, len(nicknames))
+
+	for _, nickname := range nicknames {
+		s.mu.RLock()
+		_, isLoaded := s.services[nickname]
+		_, isKnown := s.evictedInfo[nickname]
+		s.mu.RUnlock()
+
+		if isLoaded || isKnown {
+			continue
+		}
+
+		snapshot, err := s.storage.Load(nickname)
+		if err != nil {
+			s.logger.Errorf("can't load sandbox with nickname %s: %v", nickname, err)
+
+			continue
+		}
+
+		saved[nickname] = models.SandboxInfo{
+			Nickname:       nickname,
+			ProductsCount:  len(snapshot.Products),
+			FeedbacksCount: len(snapshot.Feedbacks),
+			CreatedAt:      snapshot.CreatedAt,
+			LastActivityAt: snapshot.LastActivityAt,
+		}
+	}
 
 	s.mu.Lock()
-	s.services[nickname] = newService
-	s.mu.Unlock()
+	defer s.mu.Unlock()
+
+	if s.evictedInfoLoaded {
+		return
+	}
+
+	for nickname, info := range saved {
+		_, isLoaded := s.services[nickname]
+		_, isEvicting := s.evicting[nickname]
+		_, isKnown := s.evictedInfo[nickname]
+
+		if !isLoaded && !isEvicting && !isKnown {
+			s.evictedInfo[nickname] = info
+		}
+	}
+
+	s.evictedInfoLoaded = true
+}
+
+// getSandbox returns the caller's sandbox, loading it if needed. The sandbox stays in memory
+// until release is called, so changes of a request never go to an evicted copy.
+func (s *ProductIsolationService) getSandbox(ctx context.Context) (*sandbox, func()) {
+	nickname := models.SandboxOwnerFromContext(ctx)
+
+	for {
+		current := s.lookupSandbox(nickname)
+
+		// the sandbox may be evicted between the lookup and acquire, then it is loaded again
+		if release, ok := current.acquire(); ok {
+			current.touch()
+
+			return current, release
+		}
+	}
+}
+
+// lookupSandbox returns the loaded sandbox of the nickname or loads it. A sandbox which is being
+// evicted is loaded only after its eviction is finished.
+func (s *ProductIsolationService) lookupSandbox(nickname string) *sandbox {
+	for {
+		s.mu.RLock()
+		existing, has := s.services[nickname]
+		evicting, isEvicting := s.evicting[nickname]
+		evictions := s.evictions
+		s.mu.RUnlock()
+
+		if has {
+			return existing
+		}
+
+		if isEvicting {
+			<-evicting.evictedCh
+
+			continue
+		}
+
+		loaded := s.loadSandbox(nickname)
+
+		s.mu.Lock()
+
+		if existing, has = s.services[nickname]; has {
+			s.mu.Unlock()
+
+			return existing
+		}
+
+		// an eviction started or finished during the load, so the storage may have had an older state
+		if _, isEvicting = s.evicting[nickname]; isEvicting || s.evictions != evictions {
+			s.mu.Unlock()
+
+			continue
+		}
+
+		s.services[nickname] = loaded
+		delete(s.evictedInfo, nickname)
+		victims := s.evictOverflow()
+
+		s.mu.Unlock()
+
+		s.finishEvictions(victims)
+
+		return loaded
+	}
+}
+
+// loadSandbox reads a previously evicted sandbox from the storage or creates a new one from initial data.
+func (s *ProductIsolationService) loadSandbox(nickname string) *sandbox {
+	if s.storage != nil {
+		snapshot, err := s.storage.Load(nickname)
+
+		switch {
+		case err == nil:
+			loaded := s.restoreSandbox(nickname, snapshot)
+			loaded.touch()
+
+			s.logger.Infof("Sandbox with nickname %s loaded from storage", nickname)
+
+			return loaded
+		case !errors.Is(err, models.ErrNotFound):
+			s.logger.Errorf("can't load sandbox with nickname %s, creating a new one: %v", nickname, err)
+		}
+	}
 
 	s.logger.Infof("New Product isolation service with nickname %s created", nickname)
 
-	return newService
+	return s.buildSandbox(nickname, s.seedSnapshot(), s.clock.Now())
+}
+
+// seedSnapshot returns the initial data of a new sandbox, products are numbered in the seed order.
+func (s *ProductIsolationService) seedSnapshot() models.SandboxSnapshot {
+	snapshot := models.SandboxSnapshot{
+		Products:            s.initProducts,
+		ProductSequences:    make(map[string]uint64, len(s.initProducts)),
+		LastProductSequence: uint64(len(s.initProducts)),
+	}
+
+	for i, product := range s.initProducts {
+		snapshot.ProductSequences[product.ID] = uint64(i + 1)
+	}
+
+	s.initFeedbacks.ExportTo(&snapshot)
+
+	return snapshot
+}
+
+func (s *ProductIsolationService) restoreSandbox(nickname string, snapshot models.SandboxSnapshot) *sandbox {
+	createdAt := snapshot.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = s.clock.Now()
+	}
+
+	fillTimestamps(snapshot, s.clock.Now())
+
+	restored := s.buildSandbox(nickname, snapshot, createdAt)
+	restored.stored.Store(true)
+
+	if !snapshot.LastActivityAt.IsZero() {
+		restored.lastActivity.Store(snapshot.LastActivityAt.UnixNano())
+	}
+
+	return restored
+}
+
+// buildSandbox creates services of the sandbox, they own the snapshot maps after the call.
+func (s *ProductIsolationService) buildSandbox(nickname string, snapshot models.SandboxSnapshot, createdAt time.Time) *sandbox {
+	events := s.events.Hold(nickname)
+	feedbacks := NewFeedbackSandbox(snapshot, s.categories, s.clock, events, s.logger)
+
+	products := NewProductService(snapshot, feedbacks, s.categories, s.clock, events, ShopID(nickname))
+
+	return newSandbox(nickname, products, s.clock, createdAt)
+}
+
+// SubscribeEvents subscribes to changes of the caller's sandbox, see EventStream.Subscribe.
+// It doesn't load the sandbox, so an open stream doesn't keep an idle sandbox in memory.
+func (s *ProductIsolationService) SubscribeEvents(
+	ctx context.Context,
+	lastEventID uint64,
+) (missed []models.Event, events <-chan models.Event, cancel func()) {
+	return s.events.Subscribe(models.SandboxOwnerFromContext(ctx), lastEventID)
+}
+
+// persist writes the current sandbox state to the storage. Snapshots of one sandbox
+// are taken and written one at a time, so an older state never overwrites a newer one.
+// Requests only mark sandboxes unsaved, the janitor persists them in batches.
+func (s *ProductIsolationService) persist(sandbox *sandbox) {
+	if s.storage == nil {
+		return
+	}
+
+	sandbox.persistMu.Lock()
+	defer sandbox.persistMu.Unlock()
+
+	// cleared before the snapshot is taken, so changes made after it mark the sandbox again
+	sandbox.unsaved.Store(false)
+
+	if err := s.storage.Save(sandbox.nickname, sandbox.snapshot()); err != nil {
+		sandbox.unsaved.Store(true)
+		s.logger.Errorf("can't save sandbox with nickname %s: %v", sandbox.nickname, err)
+
+		return
+	}
+
+	sandbox.stored.Store(true)
+}
+
+func validateSnapshot(snapshot models.SandboxSnapshot, categories *CategoryRegistry) error {
+	fields := make(map[string]string)
+	productIDs := make(map[string]struct{}, len(snapshot.Products))
+
+	for i, product := range snapshot.Products {
+		prefix := fmt.Sprintf("products[%d]", i)
+
+		if product.ID == "" {
+			fields[prefix+".id"] = "must not be empty"
+		} else if _, has := productIDs[product.ID]; has {
+			fields[prefix+".id"] = "must be unique"
+		}
+
+		productIDs[product.ID] = struct{}{}
+
+		if product.OrdersCount < 0 {
+			fields[prefix+".ordersCount"] = "must not be negative"
+		}
+
+		if product.RefundsCount < 0 {
+			fields[prefix+".refundsCount"] = "must not be negative"
+		}
+
+		if product.WarehouseQuantity < 0 {
+			fields[prefix+".warehouseQuantity"] = "must not be negative"
+		}
+
+		if product.LowStockThreshold < 0 {
+			fields[prefix+".lowStockThreshold"] = "must not be negative"
+		}
+
+		var productErr *models.ValidationError
+		if errors.As(validateProductInput(product.ToInput(), categories), &productErr) {
+			for field, message := range productErr.Fields {
+				fields[prefix+"."+field] = message
+			}
+		}
+	}
+
+	validateSnapshotSequences(snapshot, fields)
+
+	for id, feedback := range snapshot.Feedbacks {
+		prefix := "feedbacks." + id
+
+		switch {
+		case feedback == nil || feedback.ID != id:
+			fields[prefix+".id"] = "must match the key"
+		case feedback.Rating < minFeedbackRating || feedback.Rating > maxFeedbackRating:
+			fields[prefix+".rating"] = "must be from 1 to 5"
+		case feedback.Reply != nil && validateReplyInput(models.FeedbackReplyInput{Text: feedback.Reply.Text}) != nil:
+			fields[prefix+".reply.text"] = "must be a valid reply"
+		}
+	}
+
+	validateSnapshotOrders(snapshot.Orders, fields)
+	validateSnapshotRefunds(snapshot.Refunds, snapshot.Orders, fields)
+	validateSnapshotStockMovements(snapshot.StockMovements, productIDs, fields)
+
+	for productID, feedbackIDs := range snapshot.FeedbacksPerProduct {
+		prefix := "feedbacksPerProduct." + productID
+
+		if _, has := productIDs[productID]; !has {
+			fields[prefix] = "product not found"
+
+			continue
+		}
+
+		var lastSequence uint64
+
+		for _, id := range feedbackIDs {
+			feedback, has := snapshot.Feedbacks[id]
+			if !has {
+				fields[prefix] = fmt.Sprintf("feedback %s not found", id)
+
+				continue
+			}
+
+			if feedback == nil {
+				continue
+			}
+
+			if feedback.Sequence <= lastSequence {
+				fields["feedbacks."+id+".sequence"] = "must be positive and grow within the product feedbacks"
+			}
+
+			lastSequence = feedback.Sequence
+		}
+	}
+
+	if len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+// validateSnapshotSequences checks that every product has a sequence and they grow in the products order,
+// as cursors expect.
+func validateSnapshotSequences(snapshot models.SandboxSnapshot, fields map[string]string) {
+	var previous uint64
+
+	for _, product := range snapshot.Products {
+		sequence := snapshot.ProductSequences[product.ID]
+		if sequence <= previous {
+			fields[fmt.Sprintf("productSequences.%s", product.ID)] = "must grow in the products order"
+		}
+
+		previous = max(previous, sequence)
+	}
+
+	if snapshot.LastProductSequence < previous {
+		fields["lastProductSequence"] = "must not be less than product sequences"
+	}
 }
@@ -0,0 +1,1540 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+
+	"seller-pages/internal/config"
+	"seller-pages/internal/models"
+)
+
+const (
+	seedProductsCount = 60
+	sandboxesCount    = 30
+
+	testCategory = "Электроника"
+)
+
+type ProductIsolationSuite struct {
+	suite.Suite
+
+	seed     []models.Product
+	seedCopy []models.Product
+	clock    *manualClock
+	service  *ProductIsolationService
+}
+
+func TestProductIsolation(t *testing.T) {
+	suite.Run(t, &ProductIsolationSuite{})
+}
+
+func (s *ProductIsolationSuite) SetupTest() {
+	s.seed = make([]models.Product, seedProductsCount)
+	for i := range s.seed {
+		s.seed[i] = models.Product{
+			ID:          fmt.Sprintf("product-%02d", i),
+			Name:        fmt.Sprintf("Product %d", i),
+			Article:     randomArticle(),
+			Category:    testCategory,
+			IsRemovable: true,
+			Price:       float64(100 + i),
+			OrdersCount: 10,
+
+			WarehouseQuantity: 5,
+		}
+	}
+
+	s.seedCopy = slices.Clone(s.seed)
+
+	categories, err := NewCategoryRegistry([]models.Category{
+		{ID: "tech", Name: "Техника"},
+		{
+			ID:       "electronics",
+			Name:     testCategory,
+			ParentID: "tech",
+			Names:    []string{"Ноутбук"},
+			Images:   []string{"image"},
+			MinPrice: 100,
+			MaxPrice: 200,
+		},
+	})
+	s.Require().NoError(err)
+
+	s.clock = &manualClock{now: time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)}
+
+	feedbackService := &FeedbackService{
+		feedbacks:           make(map[string]*models.Feedback),
+		feedbacksPerProduct: make(map[string][]string),
+		clock:               s.clock,
+		logger:              zap.NewNop().Sugar(),
+	}
+
+	for _, product := range s.seed {
+		for i := range 3 {
+			id := fmt.Sprintf("%s-feedback-%d", product.ID, i)
+
+			feedbackService.feedbacks[id] = &models.Feedback{ID: id, Sequence: uint64(i + 1), Rating: i + 1, PhotosURL: []string{"photo"}}
+			feedbackService.feedbacksPerProduct[product.ID] = append(feedbackService.feedbacksPerProduct[product.ID], id)
+		}
+	}
+
+	s.service = NewProductIsolationService(
+		s.seed,
+		feedbackService,
+		categories,
+		s.clock,
+		NewEventBus(zap.NewNop().Sugar()),
+		nil,
+		config.SandboxOpts{},
+		zap.NewNop().Sugar(),
+	)
+}
+
+func (s *ProductIsolationSuite) TestConcurrentDeletesDoNotLeakBetweenSandboxes() {
+	deleted := make([]map[string]struct{}, sandboxesCount)
+
+	wg := sync.WaitGroup{}
+
+	for sandbox := range sandboxesCount {
+		deleted[sandbox] = make(map[string]struct{})
+
+		for i, product := range s.seed {
+			if i%sandboxesCount == sandbox || rand.Intn(3) == 0 {
+				deleted[sandbox][product.ID] = struct{}{}
+			}
+		}
+
+		toDelete := make([]string, 0, len(deleted[sandbox]))
+		for id := range deleted[sandbox] {
+			toDelete = append(toDelete, id)
+		}
+
+		rand.Shuffle(len(toDelete), func(i, j int) {
+			toDelete[i], toDelete[j] = toDelete[j], toDelete[i]
+		})
+
+		ctx := sandboxContext(sandbox)
+
+		for _, id := range toDelete {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				s.NoError(s.service.DeleteProductByID(ctx, id))
+			}()
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for page := 1; page <= 3; page++ {
+				_, _, err := s.service.GetProductsList(ctx, pageOf(page), models.ProductFilter{})
+				s.NoError(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	s.Equal(s.seedCopy, s.seed, "seed products must stay untouched")
+
+	for sandbox := range sandboxesCount {
+		expected := make([]string, 0, seedProductsCount)
+		for _, product := range s.seed {
+			if _, has := deleted[sandbox][product.ID]; !has {
+				expected = append(expected, product.ID)
+			}
+		}
+
+		s.Equal(expected, s.listProductIDs(sandboxContext(sandbox)), "sandbox %d", sandbox)
+	}
+
+	s.Len(s.listProductIDs(sandboxContext(sandboxesCount)), seedProductsCount, "new sandbox must get full seed")
+}
+
+func (s *ProductIsolationSuite) TestUpdateDoesNotLeakBetweenSandboxes() {
+	owner := sandboxContext(0)
+	neighbour := sandboxContext(1)
+
+	before, err := s.service.GetProductByID(neighbour, s.seed[0].ID)
+	s.Require().NoError(err)
+
+	input := s.seed[0].ToInput()
+	input.Name = "Renamed"
+	input.Price = 1
+
+	_, err = s.service.UpdateProduct(owner, s.seed[0].ID, input)
+	s.Require().NoError(err)
+
+	after, err := s.service.GetProductByID(neighbour, s.seed[0].ID)
+	s.Require().NoError(err)
+
+	s.Equal(before, after)
+	s.Equal(s.seedCopy, s.seed)
+
+	updated, err := s.service.GetProductByID(owner, s.seed[0].ID)
+	s.Require().NoError(err)
+	s.Equal("Renamed", updated.Name)
+}
+
+func (s *ProductIsolationSuite) TestFeedbacksAreIsolatedAndDeletedWithProduct() {
+	owner := sandboxContext(0)
+	neighbour := sandboxContext(1)
+
+	s.Require().NoError(s.service.DeleteProductByID(owner, s.seed[0].ID))
+
+	feedbacks, _, err := s.service.GetProductsWithFeedbacks(neighbour, pageOf(1), models.FeedbackFilter{})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(feedbacks)
+	s.Equal(s.seed[0].ID, feedbacks[0].ID)
+	s.Len(feedbacks[0].Feedbacks, 3)
+
+	feedbacks[0].Feedbacks[0].PhotosURL[0] = "changed"
+
+	feedbacks, _, err = s.service.GetProductsWithFeedbacks(neighbour, pageOf(1), models.FeedbackFilter{})
+	s.Require().NoError(err)
+	s.Equal("photo", feedbacks[0].Feedbacks[0].PhotosURL[0], "returned feedbacks must be copies")
+
+	ownerFeedbacks := s.productsOf(owner).feedbackService.(*FeedbackService)
+	s.Len(ownerFeedbacks.feedbacks, (seedProductsCount-1)*3, "feedbacks of deleted product must be removed")
+	s.NotContains(ownerFeedbacks.feedbacksPerProduct, s.seed[0].ID)
+
+	s.Len(s.service.initFeedbacks.feedbacks, seedProductsCount*3, "seed feedbacks must stay untouched")
+}
+
+func (s *ProductIsolationSuite) TestCategoriesCountProductsOfSandbox() {
+	ctx := sandboxContext(0)
+
+	s.Require().NoError(s.service.DeleteProductByID(ctx, s.seed[0].ID))
+	s.service.AddProduct(ctx)
+	s.service.AddProduct(ctx)
+
+	tree := s.service.GetCategories(ctx)
+	s.Require().Len(tree, 1)
+	s.Equal(seedProductsCount+1, tree[0].ProductsCount, "parent must include children products")
+	s.Require().Len(tree[0].Children, 1)
+	s.Equal(seedProductsCount+1, tree[0].Children[0].ProductsCount)
+
+	s.Equal(seedProductsCount, s.service.GetCategories(sandboxContext(1))[0].ProductsCount)
+
+	_, err := s.service.CreateProduct(ctx, models.NewProductInput{ProductInput: models.ProductInput{Name: "Product", Article: "1234567890", Category: "Техника", Price: 1}})
+	s.ErrorIs(err, models.ErrBadRequest, "products must not be assigned to parent categories")
+}
+
+func (s *ProductIsolationSuite) TestNilCategoryRegistryHasNoCategories() {
+	var categories *CategoryRegistry
+
+	s.False(categories.IsAssignable(testCategory))
+	s.Empty(categories.AssignableNames())
+	s.Empty(categories.Tree(map[string]int{testCategory: 1}))
+	s.Empty(categories.randomCategory())
+	s.Contains(defaultNames, categories.randomName(testCategory))
+	s.Contains(defaultImages, categories.randomImageURL(testCategory))
+
+	price, _ := categories.randomPriceAndOldPrice(testCategory)
+	s.GreaterOrEqual(price, float64(defaultMinPrice))
+}
+
+func (s *ProductIsolationSuite) TestFeedbackReplyLifecycle() {
+	owner := sandboxContext(0)
+	feedbackID := s.seed[0].ID + "-feedback-0"
+
+	reply, err := s.service.AddFeedbackReply(owner, feedbackID, models.FeedbackReplyInput{Text: " Спасибо! "})
+	s.Require().NoError(err)
+	s.Equal("Спасибо!", reply.Text)
+
+	_, err = s.service.AddFeedbackReply(owner, feedbackID, models.FeedbackReplyInput{Text: "Еще раз"})
+	s.ErrorIs(err, models.ErrConflict)
+
+	updated, err := s.service.UpdateFeedbackReply(owner, feedbackID, models.FeedbackReplyInput{Text: "Исправлено"})
+	s.Require().NoError(err)
+	s.Equal(reply.CreatedAt, updated.CreatedAt)
+
+	feedbacks, _, err := s.service.GetProductsWithFeedbacks(owner, pageOf(1), models.FeedbackFilter{})
+	s.Require().NoError(err)
+	s.Require().NotNil(feedbacks[0].Feedbacks[0].Reply)
+	s.Equal("Исправлено", feedbacks[0].Feedbacks[0].Reply.Text)
+
+	feedbacks, _, err = s.service.GetProductsWithFeedbacks(sandboxContext(1), pageOf(1), models.FeedbackFilter{})
+	s.Require().NoError(err)
+	s.Nil(feedbacks[0].Feedbacks[0].Reply, "replies must not leak between sandboxes")
+
+	s.Require().NoError(s.service.DeleteFeedbackReply(owner, feedbackID))
+	s.ErrorIs(s.service.DeleteFeedbackReply(owner, feedbackID), models.ErrNotFound)
+}
+
+func (s *ProductIsolationSuite) TestFeedbacksReadState() {
+	ctx := sandboxContext(0)
+	productID := s.seed[0].ID
+
+	counters := s.service.GetFeedbackCounters(ctx)
+	s.Equal(models.FeedbackCounters{Unread: seedProductsCount * 3, Unanswered: seedProductsCount * 3}, counters)
+
+	counters, err := s.service.MarkFeedbacksRead(ctx, models.MarkReadInput{IDs: []string{productID + "-feedback-0"}})
+	s.Require().NoError(err)
+	s.Equal(seedProductsCount*3-1, counters.Unread)
+
+	_, err = s.service.AddFeedbackReply(ctx, productID+"-feedback-1", models.FeedbackReplyInput{Text: "Спасибо"})
+	s.Require().NoError(err)
+
+	unread := true
+	feedbacks, _, err := s.service.GetProductFeedbacks(ctx, productID, pageOf(1), models.FeedbackFilter{Unread: &unread})
+	s.Require().NoError(err)
+	s.Require().Len(feedbacks, 1, "replied feedback must become read")
+	s.Equal(productID+"-feedback-2", feedbacks[0].ID)
+
+	_, err = s.service.MarkFeedbacksRead(ctx, models.MarkReadInput{IDs: []string{productID + "-feedback-2", "unknown"}})
+	s.ErrorIs(err, models.ErrNotFound)
+	s.Equal(seedProductsCount*3-2, s.service.GetFeedbackCounters(ctx).Unread, "nothing must be marked on error")
+
+	_, err = s.service.MarkFeedbacksRead(ctx, models.MarkReadInput{})
+	s.ErrorIs(err, models.ErrBadRequest)
+
+	upTo := s.clock.Now()
+	counters, err = s.service.MarkFeedbacksRead(ctx, models.MarkReadInput{UpTo: &upTo})
+	s.Require().NoError(err)
+	s.Equal(models.FeedbackCounters{Unread: 0, Unanswered: seedProductsCount*3 - 1}, counters)
+
+	s.Equal(seedProductsCount*3, s.service.GetFeedbackCounters(sandboxContext(1)).Unread, "read state must not leak between sandboxes")
+}
+
+func (s *ProductIsolationSuite) TestFeedbackSimulator() {
+	owner := sandboxContext(0)
+	neighbour := sandboxContext(1)
+
+	s.False(s.service.GetFeedbackSimulator(neighbour).Enabled)
+
+	_, err := s.service.SetFeedbackSimulator(owner, models.SimulatorSettings{Enabled: true, IntervalSeconds: 100000})
+	s.ErrorIs(err, models.ErrBadRequest)
+
+	settings, err := s.service.SetFeedbackSimulator(owner, models.SimulatorSettings{Enabled: true, IntervalSeconds: 10})
+	s.Require().NoError(err)
+	s.Equal(models.SimulatorSettings{Enabled: true, IntervalSeconds: 10}, settings)
+
+	s.service.simulate(s.clock.Now())
+	s.Equal(seedProductsCount*3, s.service.GetShopFeedbackStats(owner).Count, "first feedback must wait for the interval")
+
+	for range 3 {
+		s.clock.Advance(10 * time.Second)
+		s.service.simulate(s.clock.Now())
+	}
+
+	s.Equal(seedProductsCount*3+3, s.service.GetShopFeedbackStats(owner).Count)
+	s.Equal(seedProductsCount*3+3, s.service.GetFeedbackCounters(owner).Unread, "new feedbacks must be unread")
+	s.Equal(seedProductsCount*3, s.service.GetShopFeedbackStats(neighbour).Count, "simulator must not leak between sandboxes")
+
+	for _, product := range s.productsOf(owner).products {
+		stats, err := s.service.GetFeedbackStats(owner, product.ID)
+		s.Require().NoError(err)
+		s.InDelta(stats.AverageRating, product.Rating, 1e-9, "product rating must follow new feedbacks")
+	}
+
+	_, err = s.service.SetFeedbackSimulator(owner, models.SimulatorSettings{Enabled: false})
+	s.Require().NoError(err)
+
+	s.clock.Advance(time.Hour)
+	s.service.simulate(s.clock.Now())
+	s.Equal(seedProductsCount*3+3, s.service.GetShopFeedbackStats(owner).Count)
+}
+
+func (s *ProductIsolationSuite) TestSimulatorDoesNotKeepSandboxLoaded() {
+	storage := &memoryStorage{snapshots: make(map[string]models.SandboxSnapshot)}
+	s.service.storage = storage
+	s.service.limits = config.SandboxOpts{IdleTTL: time.Hour}
+
+	owner := sandboxContext(0)
+	neighbour := sandboxContext(1)
+
+	for _, ctx := range []context.Context{owner, neighbour} {
+		_, err := s.service.SetFeedbackSimulator(ctx, models.SimulatorSettings{Enabled: true, IntervalSeconds: 10})
+		s.Require().NoError(err)
+	}
+
+	s.service.mu.RLock()
+	stale := s.service.services["student-1"]
+	for _, existing := range s.service.services {
+		existing.lastActivity.Store(s.clock.Now().Add(-2 * time.Hour).UnixNano())
+	}
+	s.service.mu.RUnlock()
+
+	s.service.persist(stale)
+
+	s.service.mu.Lock()
+	s.service.startEviction(stale)
+	s.service.mu.Unlock()
+	s.service.finishEvictions([]*sandbox{stale})
+
+	s.clock.Advance(10 * time.Second)
+	s.service.simulate(s.clock.Now())
+
+	s.service.simulateTurn(stale, s.clock.Now().Add(time.Hour))
+	s.Len(storage.snapshots["student-1"].Feedbacks, seedProductsCount*3, "evicted copy must not be simulated")
+
+	s.service.evictIdle(s.clock.Now())
+
+	s.service.mu.RLock()
+	s.Empty(s.service.services, "simulated turns must not count as activity")
+	s.service.mu.RUnlock()
+
+	s.Len(storage.snapshots["student-0"].Feedbacks, seedProductsCount*3+1, "simulated feedbacks must be saved on eviction")
+
+	s.False(s.service.GetFeedbackSimulator(owner).Enabled, "simulators must stop with the evicted sandbox")
+}
+
+func (s *ProductIsolationSuite) TestEventsArePublishedPerSandbox() {
+	owner := sandboxContext(0)
+
+	_, events, cancel := s.service.SubscribeEvents(owner, 0)
+	defer cancel()
+
+	_, neighbourEvents, cancelNeighbour := s.service.SubscribeEvents(sandboxContext(1), 0)
+	defer cancelNeighbour()
+
+	created, err := s.service.CreateProduct(owner, models.NewProductInput{ProductInput: models.ProductInput{Name: "New", Article: "1234567890", Category: testCategory, Price: 1}})
+	s.Require().NoError(err)
+	s.Require().NoError(s.service.DeleteProductByID(owner, created.ID))
+	_, err = s.service.AddFeedbackReply(owner, s.seed[0].ID+"-feedback-0", models.FeedbackReplyInput{Text: "Спасибо"})
+	s.Require().NoError(err)
+
+	var (
+		received []models.Event
+		types    []string
+	)
+
+	for range 5 {
+		event := s.receive(events)
+		received = append(received, event)
+		types = append(types, event.Type)
+	}
+
+	s.Equal([]string{
+		models.EventProductCreated,
+		models.EventBalanceChanged,
+		models.EventProductDeleted,
+		models.EventBalanceChanged,
+		models.EventFeedbackReplied,
+	}, types)
+	s.JSONEq(fmt.Sprintf(`{"id": %q}`, created.ID), string(received[2].Data))
+	s.Empty(neighbourEvents, "events must not leak between sandboxes")
+
+	missed, _, cancelResumed := s.service.SubscribeEvents(owner, received[0].ID)
+	defer cancelResumed()
+	s.Equal(received[1:], missed, "resumed stream must get events after Last-Event-ID")
+
+	missed, _, cancelLost := s.service.SubscribeEvents(owner, received[4].ID+100)
+	defer cancelLost()
+	s.Require().Len(missed, 1)
+	s.Equal(models.EventResync, missed[0].Type)
+
+	s.service.ResetSandbox(owner)
+	s.Equal(models.EventResync, s.receive(events).Type)
+}
+
+func (s *ProductIsolationSuite) TestEventStreamsAreDroppedWhenUnused() {
+	s.service.storage = &memoryStorage{snapshots: make(map[string]models.SandboxSnapshot)}
+	s.service.limits = config.SandboxOpts{IdleTTL: time.Hour}
+
+	s.service.GetProductsList(sandboxContext(0), pageOf(1), models.ProductFilter{})
+	_, _, cancel := s.service.SubscribeEvents(sandboxContext(0), 0)
+
+	_, _, cancelUnloaded := s.service.SubscribeEvents(sandboxContext(1), 0)
+	s.Len(s.service.events.streams, 2)
+
+	cancelUnloaded()
+	s.Len(s.service.events.streams, 1, "streams of unloaded sandboxes must be dropped with the last subscriber")
+
+	s.service.evictIdle(s.clock.Now().Add(2 * time.Hour))
+	s.Len(s.service.events.streams, 1, "streams with subscribers must outlive the sandbox")
+
+	cancel()
+	s.Empty(s.service.events.streams)
+}
+
+// receive waits for the next event, failing the test if it doesn't come.
+func (s *ProductIsolationSuite) receive(events <-chan models.Event) models.Event {
+	select {
+	case event, ok := <-events:
+		s.Require().True(ok, "events channel must not be closed")
+
+		return event
+	case <-time.After(2 * time.Second):
+		s.Require().Fail("event was not published")
+
+		return models.Event{}
+	}
+}
+
+func (s *ProductIsolationSuite) TestBalanceFollowsProducts() {
+	owner := sandboxContext(0)
+
+	initial, err := s.service.GetBalanceInfo(owner, models.ChartQuery{})
+	s.Require().NoError(err)
+	s.InDelta(77700, initial.Balance, 0.01, "balance is the sum of prices times orders")
+	s.Equal(seedProductsCount*10, initial.TotalSalesCount)
+	s.Zero(initial.TotalRefundsCount)
+	s.InDelta(2, initial.ShopRating, 0.001)
+	s.Len(initial.SalesChart.Data, defaultChartPoints[models.GranularityMonth])
+	s.Equal("Март", initial.SalesChart.Data[0].Period)
+
+	_, events, cancel := s.service.SubscribeEvents(owner, 0)
+	defer cancel()
+
+	s.Require().NoError(s.service.DeleteProductByID(owner, s.seed[0].ID))
+
+	s.Equal(models.EventProductDeleted, s.receive(events).Type)
+
+	changed := s.receive(events)
+	s.Equal(models.EventBalanceChanged, changed.Type)
+	s.JSONEq(`{"changedAt": "2025-03-10T12:00:00Z"}`, string(changed.Data), "the event must not carry the balance")
+
+	afterDelete, err := s.service.GetBalanceInfo(owner, models.ChartQuery{})
+	s.Require().NoError(err)
+	s.InDelta(initial.Balance-1000, afterDelete.Balance, 0.01)
+	s.Equal(initial.TotalSalesCount-10, afterDelete.TotalSalesCount)
+	s.Equal(initial.ShopID, afterDelete.ShopID)
+
+	neighbour, err := s.service.GetBalanceInfo(sandboxContext(1), models.ChartQuery{})
+	s.Require().NoError(err)
+	s.Equal(initial.Balance, neighbour.Balance, "balance must not leak between sandboxes")
+	s.NotEqual(initial.ShopID, neighbour.ShopID)
+}
+
+func (s *ProductIsolationSuite) TestBalanceChartRange() {
+	ctx := sandboxContext(0)
+	date := func(day string) *time.Time {
+		parsed, err := time.Parse(time.DateOnly, day)
+		s.Require().NoError(err)
+
+		return &parsed
+	}
+
+	daily, err := s.service.GetBalanceInfo(ctx, models.ChartQuery{
+		From:        date("2025-03-01"),
+		To:          date("2025-03-10"),
+		Granularity: models.GranularityDay,
+	})
+	s.Require().NoError(err)
+	s.Require().Len(daily.SalesChart.Data, 10)
+	s.Equal(models.SalePoint{Amount: daily.SalesChart.Data[0].Amount, Period: "10 марта", From: "2025-03-10", To: "2025-03-10"},
+		daily.SalesChart.Data[0])
+	s.Equal("2025-03-01", daily.SalesChart.Data[9].From)
+
+	var sum float64
+	for _, point := range daily.SalesChart.Data {
+		sum += point.Amount
+	}
+
+	s.InDelta(daily.Sales, sum, 0.1, "days of the current month sum up to its sales")
+	s.InDelta(sum/10, daily.SalesChart.AverageSales, 0.01, "average is taken over the whole range")
+
+	weekly, err := s.service.GetBalanceInfo(ctx, models.ChartQuery{From: date("2025-02-26"), Granularity: models.GranularityWeek})
+	s.Require().NoError(err)
+	s.Require().Len(weekly.SalesChart.Data, 3, "weeks are whole and start on Monday")
+	s.Equal("3–9 марта", weekly.SalesChart.Data[1].Period)
+	s.Equal("24 февраля – 2 марта", weekly.SalesChart.Data[2].Period)
+	s.Equal("2025-02-24", weekly.SalesChart.Data[2].From)
+
+	monthly, err := s.service.GetBalanceInfo(ctx, models.ChartQuery{From: date("2024-12-15")})
+	s.Require().NoError(err)
+	s.Equal(models.GranularityMonth, monthly.SalesChart.Granularity)
+	s.Require().Len(monthly.SalesChart.Data, 4)
+	s.Equal("Декабрь 2024", monthly.SalesChart.Data[3].Period)
+	s.Equal("2024-12-31", monthly.SalesChart.Data[3].To)
+
+	_, err = s.service.GetBalanceInfo(ctx, models.ChartQuery{From: date("2020-01-01"), Granularity: models.GranularityDay})
+	s.ErrorIs(err, models.ErrBadRequest)
+}
+
+func (s *ProductIsolationSuite) TestOrderLifecycle() {
+	ctx := sandboxContext(0)
+	products := s.productsOf(ctx)
+	first, second := s.seed[0].ID, s.seed[1].ID
+
+	_, err := s.createOrder(products, models.OrderInput{BuyerName: "Иван", Items: []models.OrderItemInput{
+		{ProductID: first, Quantity: 1},
+		{ProductID: second, Quantity: 6},
+	}})
+	s.ErrorIs(err, models.ErrConflict, "order must not take more than is in stock")
+
+	order, err := s.createOrder(products, models.OrderInput{BuyerName: "Иван", Items: []models.OrderItemInput{
+		{ProductID: first, Quantity: 2},
+		{ProductID: second, Quantity: 1},
+	}})
+	s.Require().NoError(err)
+	s.Equal(models.OrderStatusNew, order.Status)
+	s.InDelta(301, order.Total, 0.001, "order keeps prices at purchase time")
+
+	product, err := s.service.GetProductByID(ctx, first)
+	s.Require().NoError(err)
+	s.Equal(3, product.WarehouseQuantity)
+	s.Equal(11, product.OrdersCount)
+
+	balance, err := s.service.GetBalanceInfo(ctx, models.ChartQuery{})
+	s.Require().NoError(err)
+	s.InDelta(77700+301, balance.Balance, 0.01)
+
+	found, _, err := s.service.GetOrders(ctx, pageOf(1), models.OrderFilter{
+		Statuses:  []string{models.OrderStatusNew},
+		ProductID: second,
+		Search:    "иван",
+	})
+	s.Require().NoError(err)
+	s.Require().Len(found, 1)
+	s.Equal(order.ID, found[0].ID)
+
+	neighbourOrders, _, err := s.service.GetOrders(sandboxContext(1), pageOf(1), models.OrderFilter{})
+	s.Require().NoError(err)
+	s.Empty(neighbourOrders, "orders must not leak between sandboxes")
+
+	_, err = s.service.ChangeOrderStatus(ctx, order.ID, models.OrderStatusInput{Status: models.OrderStatusShipped})
+	s.ErrorIs(err, models.ErrConflict, "new order can't be shipped before assembling")
+
+	var validationErr *models.ValidationError
+	_, err = s.service.ChangeOrderStatus(ctx, order.ID, models.OrderStatusInput{Status: "lost"})
+	s.ErrorAs(err, &validationErr)
+
+	_, err = s.service.ChangeOrderStatus(ctx, order.ID, models.OrderStatusInput{Status: models.OrderStatusAssembling})
+	s.Require().NoError(err)
+
+	cancelled, err := s.service.ChangeOrderStatus(ctx, order.ID, models.OrderStatusInput{
+		Status: models.OrderStatusCancelled,
+		Reason: "Покупатель передумал",
+	})
+	s.Require().NoError(err)
+	s.Len(cancelled.History, 3)
+
+	product, err = s.service.GetProductByID(ctx, first)
+	s.Require().NoError(err)
+	s.Equal(5, product.WarehouseQuantity, "cancelled order returns items to the warehouse")
+	s.Equal(10, product.OrdersCount)
+
+	balance, err = s.service.GetBalanceInfo(ctx, models.ChartQuery{})
+	s.Require().NoError(err)
+	s.InDelta(77700, balance.Balance, 0.01)
+
+	_, err = s.service.ChangeOrderStatus(ctx, order.ID, models.OrderStatusInput{Status: models.OrderStatusNew})
+	s.ErrorIs(err, models.ErrConflict)
+
+	s.Len(s.service.GetSandboxSnapshot(ctx).Orders, 1)
+
+	s.service.ResetSandbox(ctx)
+
+	orders, _, err := s.service.GetOrders(ctx, pageOf(1), models.OrderFilter{})
+	s.Require().NoError(err)
+	s.Empty(orders)
+}
+
+func (s *ProductIsolationSuite) TestOrderGenerator() {
+	ctx := sandboxContext(0)
+	ordered := make(map[string]int)
+
+	for {
+		order, err := s.service.AddRandomOrder(ctx)
+		if err != nil {
+			s.Require().ErrorIs(err, models.ErrConflict, "generator must stop when nothing is in stock")
+
+			break
+		}
+
+		s.Equal(models.OrderStatusNew, order.Status)
+
+		for _, item := range order.Items {
+			s.LessOrEqual(item.Quantity, maxRandomQuantity)
+			ordered[item.ProductID] += item.Quantity
+		}
+	}
+
+	for _, product := range s.seed {
+		current, err := s.service.GetProductByID(ctx, product.ID)
+		s.Require().NoError(err)
+		s.Equal(0, current.WarehouseQuantity)
+		s.Equal(product.WarehouseQuantity, ordered[product.ID], "orders must take exactly what is in stock")
+	}
+
+	owner := sandboxContext(1)
+	neighbour := sandboxContext(2)
+
+	_, err := s.service.SetOrderSimulator(owner, models.SimulatorSettings{Enabled: true, IntervalSeconds: 10})
+	s.Require().NoError(err)
+	s.True(s.service.GetOrderSimulator(owner).Enabled)
+	s.False(s.service.GetFeedbackSimulator(owner).Enabled, "order and feedback simulators are switched separately")
+
+	s.service.simulate(s.clock.Now())
+	s.Empty(s.service.GetSandboxSnapshot(owner).Orders, "first order must wait for the interval")
+
+	for range 3 {
+		s.clock.Advance(10 * time.Second)
+		s.service.simulate(s.clock.Now())
+	}
+
+	orders := s.service.GetSandboxSnapshot(owner).Orders
+	s.Require().Len(orders, 3)
+	s.Empty(s.service.GetSandboxSnapshot(neighbour).Orders, "simulator must not leak between sandboxes")
+
+	products := s.productsOf(owner)
+	for _, product := range s.seed {
+		// without stock the simulator places no orders, which would change the refunds percent
+		products.replaceDerived(product.ID, func(product *models.Product) {
+			product.RefundsPercent = 100
+			product.WarehouseQuantity = 0
+		})
+	}
+
+	for _, order := range orders {
+		for _, status := range []string{models.OrderStatusAssembling, models.OrderStatusShipped, models.OrderStatusDelivered} {
+			_, err = s.service.ChangeOrderStatus(owner, order.ID, models.OrderStatusInput{Status: status})
+			s.Require().NoError(err)
+		}
+	}
+
+	s.clock.Advance(10 * time.Second)
+	s.service.simulate(s.clock.Now())
+
+	refunds, _, err := s.service.GetRefunds(owner, pageOf(1), models.RefundFilter{
+		Statuses: []string{models.RefundStatusPending},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(refunds, len(orders), "buyers ask to return orders in the refunds percent")
+
+	for _, refund := range refunds {
+		s.NotEmpty(refund.FeedbackID, "buyer leaves a feedback about the return")
+
+		order, err := s.service.GetOrderByID(owner, refund.OrderID)
+		s.Require().NoError(err)
+		s.Equal(models.OrderStatusDelivered, order.Status, "order is refunded only when the seller approves")
+	}
+
+	s.Len(s.service.GetSandboxSnapshot(owner).Orders, len(orders), "nothing is left in stock to order")
+}
+
+func (s *ProductIsolationSuite) TestRefundLifecycle() {
+	ctx := sandboxContext(0)
+	productID := s.seed[0].ID
+	feedbackID := productID + "-feedback-0"
+
+	order, err := s.createOrder(s.productsOf(ctx), models.OrderInput{
+		BuyerName: "Иван",
+		Items:     []models.OrderItemInput{{ProductID: productID, Quantity: 1}},
+	})
+	s.Require().NoError(err)
+
+	input := models.RefundInput{OrderID: order.ID, FeedbackID: feedbackID, Reason: "Не подошел размер"}
+
+	_, err = s.service.RequestRefund(ctx, input)
+	s.ErrorIs(err, models.ErrConflict, "only delivered orders can be returned")
+
+	for _, status := range []string{models.OrderStatusAssembling, models.OrderStatusShipped, models.OrderStatusDelivered} {
+		_, err = s.service.ChangeOrderStatus(ctx, order.ID, models.OrderStatusInput{Status: status})
+		s.Require().NoError(err)
+	}
+
+	_, err = s.service.ChangeOrderStatus(ctx, order.ID, models.OrderStatusInput{Status: models.OrderStatusRefunded})
+	s.ErrorIs(err, models.ErrConflict, "orders are refunded only through refunds")
+
+	var validationErr *models.ValidationError
+	_, err = s.service.RequestRefund(ctx, models.RefundInput{OrderID: order.ID, FeedbackID: s.seed[1].ID + "-feedback-0", Reason: "Брак"})
+	s.ErrorAs(err, &validationErr, "feedback must be about the order products")
+
+	rejected, err := s.service.RequestRefund(ctx, input)
+	s.Require().NoError(err)
+	s.Equal(models.RefundStatusPending, rejected.Status)
+	s.InDelta(order.Total, rejected.Amount, 0.001)
+
+	_, err = s.service.RequestRefund(ctx, input)
+	s.ErrorIs(err, models.ErrConflict, "order can't have two pending refunds")
+
+	_, err = s.service.ResolveRefund(ctx, rejected.ID, models.RefundResolutionInput{Status: models.RefundStatusRejected})
+	s.ErrorAs(err, &validationErr, "reject reason is required")
+
+	rejected, err = s.service.ResolveRefund(ctx, rejected.ID, models.RefundResolutionInput{
+		Status: models.RefundStatusRejected,
+		Reason: "Товар был в употреблении",
+	})
+	s.Require().NoError(err)
+	s.Equal(models.RefundStatusRejected, rejected.Status)
+	s.False(rejected.ResolvedAt.IsZero())
+
+	feedback := s.service.GetSandboxSnapshot(ctx).Feedbacks[feedbackID]
+	s.Equal(rejected.ID, feedback.RefundID)
+	s.False(feedback.IsRefund)
+
+	input.FeedbackID = ""
+	approved, err := s.service.RequestRefund(ctx, input)
+	s.Require().NoError(err, "buyer can ask again after a rejection")
+
+	pending, _, err := s.service.GetRefunds(ctx, pageOf(1), models.RefundFilter{Statuses: []string{models.RefundStatusPending}})
+	s.Require().NoError(err)
+	s.Require().Len(pending, 1)
+	s.Equal(approved.ID, pending[0].ID)
+
+	approved, err = s.service.ResolveRefund(ctx, approved.ID, models.RefundResolutionInput{Status: models.RefundStatusApproved})
+	s.Require().NoError(err)
+	s.Equal(models.RefundStatusApproved, approved.Status)
+
+	_, err = s.service.ResolveRefund(ctx, approved.ID, models.RefundResolutionInput{Status: models.RefundStatusRejected, Reason: "Поздно"})
+	s.ErrorIs(err, models.ErrConflict, "resolved refund can't be resolved again")
+
+	refunded, err := s.service.GetOrderByID(ctx, order.ID)
+	s.Require().NoError(err)
+	s.Equal(models.OrderStatusRefunded, refunded.Status)
+
+	product, err := s.service.GetProductByID(ctx, productID)
+	s.Require().NoError(err)
+	s.Equal(5, product.WarehouseQuantity, "refunded items return to the warehouse")
+	s.Equal(1, product.RefundsCount)
+	s.InDelta(100.0/11, product.RefundsPercent, 0.001)
+
+	balance, err := s.service.GetBalanceInfo(ctx, models.ChartQuery{})
+	s.Require().NoError(err)
+	s.InDelta(77700, balance.Balance, 0.01, "approved refund takes the order total back")
+	s.Equal(1, balance.TotalRefundsCount)
+	s.InDelta(100.0/float64(seedProductsCount*10+1), balance.TotalRefundsPercent, 0.001)
+
+	stats, err := s.service.GetFeedbackStats(ctx, productID)
+	s.Require().NoError(err)
+	s.InDelta(product.RefundsPercent, stats.RefundsPercent, 0.001, "feedback stats must count refunds of orders")
+	s.InDelta(balance.TotalRefundsPercent, s.service.GetShopFeedbackStats(ctx).RefundsPercent, 0.001)
+
+	all, _, err := s.service.GetRefunds(ctx, pageOf(1), models.RefundFilter{OrderID: order.ID, Sort: models.SortByCreatedAt})
+	s.Require().NoError(err)
+	s.Len(all, 2)
+	s.Len(s.service.GetSandboxSnapshot(ctx).Refunds, 2)
+
+	neighbour, _, err := s.service.GetRefunds(sandboxContext(1), pageOf(1), models.RefundFilter{})
+	s.Require().NoError(err)
+	s.Empty(neighbour, "refunds must not leak between sandboxes")
+}
+
+func (s *ProductIsolationSuite) TestStockMovements() {
+	ctx := sandboxContext(0)
+	products := s.productsOf(ctx)
+	productID := s.seed[0].ID
+
+	var validationErr *models.ValidationError
+	_, err := s.service.AdjustStock(ctx, productID, models.StockAdjustmentInput{Type: models.StockMovementOrder, Quantity: 1, Reason: "Заказ"})
+	s.ErrorAs(err, &validationErr, "orders move stock only by themselves")
+
+	_, err = s.service.AdjustStock(ctx, productID, models.StockAdjustmentInput{Type: models.StockMovementWriteOff, Quantity: 6, Reason: "Брак"})
+	s.ErrorIs(err, models.ErrConflict, "stock can't be written off below zero")
+
+	_, err = s.service.SetLowStockThreshold(ctx, productID, models.LowStockThresholdInput{LowStockThreshold: 2})
+	s.Require().NoError(err)
+
+	received, err := s.service.AdjustStock(ctx, productID, models.StockAdjustmentInput{
+		Type:     models.StockMovementReceipt,
+		Quantity: 5,
+		Reason:   "Поставка",
+	})
+	s.Require().NoError(err)
+	s.Equal(5, received.Quantity)
+	s.Equal(10, received.QuantityAfter)
+
+	_, err = s.createOrder(products, models.OrderInput{BuyerName: "Иван", Items: []models.OrderItemInput{
+		{ProductID: productID, Quantity: 7},
+		{ProductID: s.seed[1].ID, Quantity: 6},
+	}})
+	s.ErrorIs(err, models.ErrConflict)
+
+	order, err := s.createOrder(products, models.OrderInput{BuyerName: "Иван", Items: []models.OrderItemInput{
+		{ProductID: productID, Quantity: 7},
+	}})
+	s.Require().NoError(err)
+
+	_, events, cancel := s.service.SubscribeEvents(ctx, 0)
+	defer cancel()
+
+	_, err = s.service.AdjustStock(ctx, productID, models.StockAdjustmentInput{Type: models.StockMovementWriteOff, Quantity: 1, Reason: "Брак"})
+	s.Require().NoError(err)
+
+	s.Equal(models.EventProductUpdated, s.receive(events).Type)
+	s.Equal(models.EventProductLowStock, s.receive(events).Type)
+
+	lowStock := s.service.GetLowStockProducts(ctx)
+	s.Require().Len(lowStock, 1)
+	s.Equal(productID, lowStock[0].ID)
+	s.Equal(2, lowStock[0].WarehouseQuantity)
+	s.Empty(s.service.GetLowStockProducts(sandboxContext(1)), "stock must not leak between sandboxes")
+
+	_, err = s.service.ChangeOrderStatus(ctx, order.ID, models.OrderStatusInput{Status: models.OrderStatusCancelled})
+	s.Require().NoError(err)
+	s.Empty(s.service.GetLowStockProducts(ctx), "cancelled order returns the reserved stock")
+
+	corrected, err := s.service.AdjustStock(ctx, productID, models.StockAdjustmentInput{
+		Type:     models.StockMovementCorrection,
+		Quantity: 4,
+		Reason:   "Инвентаризация",
+	})
+	s.Require().NoError(err)
+	s.Equal(-5, corrected.Quantity)
+	s.Equal(4, corrected.QuantityAfter)
+
+	journal, _, err := s.service.GetStockMovements(ctx, productID, pageOf(1), models.StockMovementFilter{})
+	s.Require().NoError(err)
+
+	types := make([]string, len(journal))
+	for i, movement := range journal {
+		types[i] = movement.Type
+	}
+
+	s.Equal([]string{
+		models.StockMovementReceipt,
+		models.StockMovementOrder,
+		models.StockMovementWriteOff,
+		models.StockMovementCancellation,
+		models.StockMovementCorrection,
+	}, types, "rejected order must not move stock")
+
+	orderMovements, _, err := s.service.GetStockMovements(ctx, productID, pageOf(1), models.StockMovementFilter{
+		Types: []string{models.StockMovementOrder},
+	})
+	s.Require().NoError(err)
+	s.Require().Len(orderMovements, 1)
+	s.Equal(order.ID, orderMovements[0].OrderID)
+	s.Equal(-7, orderMovements[0].Quantity)
+
+	s.Len(s.service.GetSandboxSnapshot(ctx).StockMovements, len(journal))
+
+	s.Require().NoError(s.service.DeleteProductByID(ctx, productID))
+
+	_, _, err = s.service.GetStockMovements(ctx, productID, pageOf(1), models.StockMovementFilter{})
+	s.ErrorIs(err, models.ErrNotFound)
+	s.Empty(s.service.GetSandboxSnapshot(ctx).StockMovements, "journal is deleted with the product")
+}
+
+func (s *ProductIsolationSuite) TestStockJournalKeepsLatestMovements() {
+	ctx := sandboxContext(0)
+	productID := s.seed[0].ID
+
+	for range maxStockMovements + 10 {
+		_, err := s.service.AdjustStock(ctx, productID, models.StockAdjustmentInput{
+			Type:     models.StockMovementReceipt,
+			Quantity: 1,
+			Reason:   "Поставка",
+		})
+		s.Require().NoError(err)
+	}
+
+	first, pagination, err := s.service.GetStockMovements(ctx, productID, models.PageRequest{PageSize: 10}, models.StockMovementFilter{})
+	s.Require().NoError(err)
+	s.Equal(maxStockMovements/10, pagination.TotalPages, "oldest movements must be dropped")
+	s.Equal(uint64(11), first[0].Sequence)
+
+	_, err = s.service.AdjustStock(ctx, productID, models.StockAdjustmentInput{
+		Type:     models.StockMovementWriteOff,
+		Quantity: 1,
+		Reason:   "Брак",
+	})
+	s.Require().NoError(err)
+
+	second, _, err := s.service.GetStockMovements(ctx, productID, models.PageRequest{PageSize: 10, Cursor: pagination.NextCursor}, models.StockMovementFilter{})
+	s.Require().NoError(err)
+	s.Equal(first[len(first)-1].Sequence+1, second[0].Sequence, "dropping old movements must not shift the next page")
+
+	snapshot := s.service.GetSandboxSnapshot(ctx)
+	s.Require().NoError(s.service.RestoreSandbox(ctx, snapshot))
+
+	restored, _, err := s.service.GetStockMovements(ctx, productID, models.PageRequest{PageSize: 10}, models.StockMovementFilter{})
+	s.Require().NoError(err)
+	s.Equal(first[0].Sequence+1, restored[0].Sequence, "sequences must survive restores")
+
+	var validationErr *models.ValidationError
+
+	snapshot.StockMovements[0].Sequence = 0
+	s.Require().ErrorAs(s.service.RestoreSandbox(ctx, snapshot), &validationErr)
+	s.Contains(validationErr.Fields, "stockMovements[0].sequence")
+
+	snapshot.StockMovements[0].Sequence = 1
+	snapshot.StockMovements[2].Sequence = snapshot.StockMovements[1].Sequence
+
+	s.Require().ErrorAs(s.service.RestoreSandbox(ctx, snapshot), &validationErr)
+	s.Contains(validationErr.Fields, "stockMovements[2].sequence")
+}
+
+func (s *ProductIsolationSuite) TestOrdersAreCapped() {
+	ctx := sandboxContext(0)
+	snapshot := s.service.GetSandboxSnapshot(ctx)
+
+	for i := range maxOrders {
+		snapshot.Orders = append(snapshot.Orders, models.Order{
+			ID:        fmt.Sprintf("order-%d", i),
+			BuyerName: "Покупатель",
+			Items:     []models.OrderItem{{ProductID: s.seed[0].ID, Name: s.seed[0].Name, Price: s.seed[0].Price, Quantity: 1}},
+			Total:     s.seed[0].Price,
+			Status:    models.OrderStatusCancelled,
+			History:   []models.OrderStatusChange{{Status: models.OrderStatusCancelled, ChangedAt: s.clock.Now()}},
+			CreatedAt: s.clock.Now(),
+			UpdatedAt: s.clock.Now(),
+		})
+	}
+
+	s.Require().NoError(s.service.RestoreSandbox(ctx, snapshot))
+
+	_, err := s.service.AddRandomOrder(ctx)
+	s.ErrorIs(err, models.ErrConflict, "full sandbox must not grow")
+
+	snapshot.Orders = append(snapshot.Orders, snapshot.Orders[0])
+	snapshot.Orders[maxOrders].ID = "order-extra"
+
+	var validationErr *models.ValidationError
+	s.Require().ErrorAs(s.service.RestoreSandbox(ctx, snapshot), &validationErr)
+	s.Contains(validationErr.Fields, "orders")
+}
+
+func (s *ProductIsolationSuite) TestProductFeedbacksFilterAndSort() {
+	ctx := sandboxContext(0)
+	productID := s.seed[0].ID
+
+	_, err := s.service.AddFeedbackReply(ctx, productID+"-feedback-1", models.FeedbackReplyInput{Text: "Спасибо"})
+	s.Require().NoError(err)
+
+	filter := models.FeedbackFilter{Sort: models.SortByRating, Descending: true}
+
+	first, pagination, err := s.service.GetProductFeedbacks(ctx, productID, models.PageRequest{PageSize: 2}, filter)
+	s.Require().NoError(err)
+	s.Equal(2, pagination.TotalPages)
+	s.Require().Len(first, 2)
+	s.Equal([]int{3, 2}, []int{first[0].Rating, first[1].Rating})
+
+	second, pagination, err := s.service.GetProductFeedbacks(ctx, productID, models.PageRequest{PageSize: 2, Cursor: pagination.NextCursor}, filter)
+	s.Require().NoError(err)
+	s.Require().Len(second, 1)
+	s.Equal(1, second[0].Rating)
+	s.Empty(pagination.NextCursor)
+
+	hasReply := false
+	unanswered, _, err := s.service.GetProductFeedbacks(ctx, productID, pageOf(1), models.FeedbackFilter{HasReply: &hasReply, Ratings: []int{1, 2}})
+	s.Require().NoError(err)
+	s.Require().Len(unanswered, 1)
+	s.Equal(productID+"-feedback-0", unanswered[0].ID)
+
+	_, _, err = s.service.GetProductFeedbacks(ctx, "unknown", pageOf(1), models.FeedbackFilter{})
+	s.ErrorIs(err, models.ErrNotFound)
+}
+
+func (s *ProductIsolationSuite) TestFeedbackSequencesAreStored() {
+	ctx := sandboxContext(0)
+	product := s.seed[0]
+
+	feedbacks, _, err := s.service.GetProductFeedbacks(ctx, product.ID, pageOf(1), models.FeedbackFilter{})
+	s.Require().NoError(err)
+	s.Require().Len(feedbacks, 3)
+	s.Equal([]uint64{1, 2, 3}, []uint64{feedbacks[0].Sequence, feedbacks[1].Sequence, feedbacks[2].Sequence})
+
+	added := s.productsOf(ctx).feedbackService.AddRandomFeedback(product)
+	s.Equal(uint64(4), added.Sequence)
+
+	snapshot := s.service.GetSandboxSnapshot(ctx)
+	s.Equal(uint64(4), snapshot.Feedbacks[added.ID].Sequence, "sequences must be saved with feedbacks")
+
+	s.Require().NoError(s.service.RestoreSandbox(ctx, snapshot))
+
+	feedbacks, _, err = s.service.GetProductFeedbacks(ctx, product.ID, pageOf(1), models.FeedbackFilter{})
+	s.Require().NoError(err)
+	s.Require().Len(feedbacks, 4)
+	s.Equal(added.ID, feedbacks[3].ID)
+	s.Equal(uint64(4), feedbacks[3].Sequence)
+
+	snapshot.Feedbacks[product.ID+"-feedback-0"].Sequence = 0
+
+	var validationErr *models.ValidationError
+	s.Require().ErrorAs(s.service.RestoreSandbox(ctx, snapshot), &validationErr)
+	s.Contains(validationErr.Fields, "feedbacks."+product.ID+"-feedback-0.sequence", "sequences must be stored")
+
+	snapshot.Feedbacks[product.ID+"-feedback-0"].Sequence = 2
+	snapshot.Feedbacks[product.ID+"-feedback-1"].Sequence = 2
+
+	s.Require().ErrorAs(s.service.RestoreSandbox(ctx, snapshot), &validationErr)
+	s.Contains(validationErr.Fields, "feedbacks."+product.ID+"-feedback-1.sequence")
+}
+
+func (s *ProductIsolationSuite) TestRatingIsComputedFromFeedbacks() {
+	ctx := sandboxContext(0)
+
+	product, err := s.service.GetProductByID(ctx, s.seed[0].ID)
+	s.Require().NoError(err)
+	s.InDelta(2, product.Rating, 1e-9, "seed feedbacks are rated 1, 2 and 3")
+
+	stats, err := s.service.GetFeedbackStats(ctx, s.seed[0].ID)
+	s.Require().NoError(err)
+	s.Equal(3, stats.Count)
+	s.Equal(map[int]int{1: 1, 2: 1, 3: 1, 4: 0, 5: 0}, stats.RatingCounts)
+	s.InDelta(100, stats.PhotosPercent, 1e-9)
+
+	added := s.service.AddProduct(ctx)
+	addedStats, err := s.service.GetFeedbackStats(ctx, added.ID)
+	s.Require().NoError(err)
+
+	addedInfo, err := s.service.GetProductByID(ctx, added.ID)
+	s.Require().NoError(err)
+	s.InDelta(addedStats.AverageRating, addedInfo.Rating, 1e-9)
+
+	shop := s.service.GetShopFeedbackStats(ctx)
+	s.Equal(seedProductsCount*3+addedStats.Count, shop.Count)
+}
+
+func (s *ProductIsolationSuite) TestTimestampsAndPeriodFilter() {
+	ctx := sandboxContext(0)
+	start := s.clock.Now()
+
+	seeded, err := s.service.GetProductByID(ctx, s.seed[0].ID)
+	s.Require().NoError(err)
+	s.True(seeded.CreatedAt.Before(start), "seed products must get dates in the past")
+	s.False(seeded.UpdatedAt.Before(seeded.CreatedAt))
+
+	s.clock.Advance(time.Hour)
+	created, err := s.service.CreateProduct(ctx, models.NewProductInput{ProductInput: models.ProductInput{Name: "New", Article: "1234567890", Category: testCategory, Price: 1}})
+	s.Require().NoError(err)
+	s.Equal(s.clock.Now(), created.CreatedAt)
+
+	since := start
+	products, _, err := s.service.GetProductsList(ctx, pageOf(1), models.ProductFilter{Since: &since})
+	s.Require().NoError(err)
+	s.Require().Len(products, 1)
+	s.Equal(created.ID, products[0].ID)
+
+	newest, _, err := s.service.GetProductsList(ctx, pageOf(1), models.ProductFilter{Sort: models.SortByCreatedAt, Descending: true})
+	s.Require().NoError(err)
+	s.Equal(created.ID, newest[0].ID)
+
+	s.clock.Advance(time.Hour)
+	updated, err := s.service.PatchProduct(ctx, created.ID, map[string]any{"name": "Renamed"})
+	s.Require().NoError(err)
+	s.Equal(created.CreatedAt, updated.CreatedAt)
+	s.Equal(s.clock.Now(), updated.UpdatedAt)
+
+	until := start
+	feedbacks, _, err := s.service.GetProductFeedbacks(ctx, s.seed[0].ID, pageOf(1), models.FeedbackFilter{Until: &until})
+	s.Require().NoError(err)
+	s.Len(feedbacks, 3, "seed feedbacks must be dated before now")
+}
+
+func (s *ProductIsolationSuite) TestSeedDatesDoNotChangeBetweenRestarts() {
+	fill := func(now time.Time) (models.Product, models.Feedback) {
+		snapshot := models.SandboxSnapshot{
+			Products:            []models.Product{{ID: "product"}},
+			Feedbacks:           map[string]*models.Feedback{"feedback": {ID: "feedback"}},
+			FeedbacksPerProduct: map[string][]string{"product": {"feedback"}},
+		}
+		fillTimestamps(snapshot, now)
+
+		return snapshot.Products[0], *snapshot.Feedbacks["feedback"]
+	}
+
+	product, feedback := fill(seedDatesAnchor.Add(time.Hour))
+	s.False(product.CreatedAt.After(seedDatesAnchor))
+	s.False(feedback.CreatedAt.Before(product.CreatedAt))
+
+	laterProduct, laterFeedback := fill(seedDatesAnchor.AddDate(0, 0, 3).Add(5 * time.Hour))
+	s.Equal(product, laterProduct, "dates must not drift with the day of the restart")
+	s.Equal(feedback, laterFeedback)
+}
+
+func (s *ProductIsolationSuite) TestResetRestoresInitialData() {
+	ctx := sandboxContext(0)
+
+	for _, product := range s.seed[:10] {
+		s.Require().NoError(s.service.DeleteProductByID(ctx, product.ID))
+	}
+
+	snapshot := s.service.GetSandboxSnapshot(ctx)
+	s.Len(snapshot.Products, seedProductsCount-10)
+	s.Len(snapshot.Feedbacks, (seedProductsCount-10)*3)
+
+	s.service.ResetSandbox(ctx)
+	s.Len(s.listProductIDs(ctx), seedProductsCount)
+
+	s.Require().NoError(s.service.RestoreSandbox(ctx, snapshot))
+	s.Len(s.listProductIDs(ctx), seedProductsCount-10)
+
+	restored := s.service.GetSandboxSnapshot(ctx)
+	s.Equal(snapshot.Products, restored.Products)
+	s.Equal(snapshot.Feedbacks, restored.Feedbacks)
+	s.Equal(snapshot.FeedbacksPerProduct, restored.FeedbacksPerProduct)
+}
+
+func (s *ProductIsolationSuite) TestRestoreRejectsOrdersWithoutHistory() {
+	ctx := sandboxContext(0)
+
+	snapshot := s.service.GetSandboxSnapshot(ctx)
+	snapshot.Orders = []models.Order{{
+		ID:     "order",
+		Items:  []models.OrderItem{{ProductID: s.seed[0].ID, Quantity: 1, Price: 100}},
+		Total:  100,
+		Status: models.OrderStatusRefunded,
+	}}
+
+	var validationErr *models.ValidationError
+	s.Require().ErrorAs(s.service.RestoreSandbox(ctx, snapshot), &validationErr)
+	s.Contains(validationErr.Fields, "orders[0].history")
+	s.Contains(validationErr.Fields, "orders[0].refundedAt")
+
+	snapshot.Orders[0].History = []models.OrderStatusChange{
+		{Status: models.OrderStatusNew},
+		{Status: models.OrderStatusRefunded, ChangedAt: s.clock.Now()},
+	}
+	snapshot.Orders[0].RefundedAt = s.clock.Now()
+	s.Require().NoError(s.service.RestoreSandbox(ctx, snapshot))
+
+	balance, err := s.service.GetBalanceInfo(ctx, models.ChartQuery{})
+	s.Require().NoError(err)
+	s.Equal(1, balance.TotalRefundsCount)
+}
+
+func (s *ProductIsolationSuite) TestRestoreRequiresProductSequences() {
+	ctx := sandboxContext(0)
+
+	snapshot := s.service.GetSandboxSnapshot(ctx)
+	delete(snapshot.ProductSequences, s.seed[1].ID)
+	snapshot.LastProductSequence = 0
+
+	var validationErr *models.ValidationError
+	s.Require().ErrorAs(s.service.RestoreSandbox(ctx, snapshot), &validationErr)
+	s.Contains(validationErr.Fields, "productSequences."+s.seed[1].ID)
+	s.Contains(validationErr.Fields, "lastProductSequence")
+}
+
+func (s *ProductIsolationSuite) TestRestoreRejectsNegativeCounters() {
+	ctx := sandboxContext(0)
+
+	snapshot := s.service.GetSandboxSnapshot(ctx)
+	snapshot.Products[0].OrdersCount = -100
+	snapshot.Products[1].RefundsCount = -1
+	snapshot.Products[2].WarehouseQuantity = -1
+
+	var validationErr *models.ValidationError
+	s.Require().ErrorAs(s.service.RestoreSandbox(ctx, snapshot), &validationErr)
+	s.Contains(validationErr.Fields, "products[0].ordersCount")
+	s.Contains(validationErr.Fields, "products[1].refundsCount")
+	s.Contains(validationErr.Fields, "products[2].warehouseQuantity")
+
+	s.NotPanics(func() {
+		s.Contains([]int{0, 1}, weightedIndex([]int{-100, 0}))
+	})
+}
+
+func (s *ProductIsolationSuite) TestSandboxActivityFollowsClock() {
+	s.service.storage = &memoryStorage{snapshots: make(map[string]models.SandboxSnapshot)}
+	s.service.limits = config.SandboxOpts{IdleTTL: time.Hour}
+
+	created := s.clock.Now()
+	s.Require().NoError(s.service.DeleteProductByID(sandboxContext(0), s.seed[0].ID))
+
+	s.clock.Advance(30 * time.Minute)
+	s.service.GetProductsList(sandboxContext(1), pageOf(1), models.ProductFilter{})
+
+	s.clock.Advance(45 * time.Minute)
+	s.service.evictIdle(s.clock.Now())
+
+	s.service.mu.RLock()
+	s.NotContains(s.service.services, "student-0", "idle time must be measured by the service clock")
+	s.Contains(s.service.services, "student-1")
+	s.service.mu.RUnlock()
+
+	sandboxes, err := s.service.ListSandboxes(teacherContext())
+	s.Require().NoError(err)
+	s.Require().Len(sandboxes, 2)
+
+	for _, info := range sandboxes {
+		if info.Nickname == "student-0" {
+			s.Equal(created, info.CreatedAt)
+			s.WithinDuration(created, info.LastActivityAt, 0)
+		}
+	}
+
+	s.Len(s.listProductIDs(sandboxContext(0)), seedProductsCount-1)
+}
+
+func (s *ProductIsolationSuite) TestEvictedSandboxesAreLoadedFromStorage() {
+	storage := &memoryStorage{snapshots: make(map[string]models.SandboxSnapshot)}
+	s.service.storage = storage
+	s.service.limits = config.SandboxOpts{IdleTTL: time.Hour, MaxCount: 2}
+
+	s.Require().NoError(s.service.DeleteProductByID(sandboxContext(0), s.seed[0].ID))
+	s.clock.Advance(time.Second)
+	s.service.GetProductsList(sandboxContext(1), pageOf(1), models.ProductFilter{})
+	s.clock.Advance(time.Second)
+	s.service.GetProductsList(sandboxContext(2), pageOf(1), models.ProductFilter{})
+
+	s.service.mu.RLock()
+	s.Len(s.service.services, 2, "least recently used sandbox must be evicted")
+	s.NotContains(s.service.services, "student-0")
+	s.service.mu.RUnlock()
+
+	s.service.evictIdle(s.clock.Now().Add(2 * time.Hour))
+
+	s.service.mu.RLock()
+	s.Empty(s.service.services, "idle sandboxes must be evicted")
+	s.service.mu.RUnlock()
+
+	s.Len(s.listProductIDs(sandboxContext(0)), seedProductsCount-1, "changes must survive eviction")
+	s.Len(s.listProductIDs(sandboxContext(1)), seedProductsCount)
+
+	sandboxes, err := s.service.ListSandboxes(teacherContext())
+	s.Require().NoError(err)
+	s.Len(sandboxes, 2)
+
+	loads := storage.loads
+
+	sandboxes, err = s.service.ListSandboxes(teacherContext())
+	s.Require().NoError(err)
+	s.Len(sandboxes, 2)
+	s.Equal(loads, storage.loads, "stats of evicted sandboxes must be kept in memory")
+}
+
+func (s *ProductIsolationSuite) TestChangesAreSavedInBatches() {
+	storage := &memoryStorage{snapshots: make(map[string]models.SandboxSnapshot)}
+	s.service.storage = storage
+
+	ctx := sandboxContext(0)
+
+	s.Require().NoError(s.service.DeleteProductByID(ctx, s.seed[0].ID))
+	s.Require().NoError(s.service.DeleteProductByID(ctx, s.seed[1].ID))
+	s.Zero(storage.saves, "requests must not write the storage")
+
+	s.service.flushUnsaved()
+	s.Equal(1, storage.saves, "changes must be saved together")
+	s.Len(storage.snapshots["student-0"].Products, seedProductsCount-2)
+
+	s.service.flushUnsaved()
+	s.Equal(1, storage.saves, "unchanged sandboxes must not be saved again")
+
+	s.service.GetProductsList(sandboxContext(1), pageOf(1), models.ProductFilter{})
+	s.service.flushUnsaved()
+	s.Equal(1, storage.saves, "reads must not be saved")
+}
+
+func (s *ProductIsolationSuite) TestEvictionWaitsForRequests() {
+	storage := &memoryStorage{snapshots: make(map[string]models.SandboxSnapshot)}
+	s.service.storage = storage
+	s.service.limits = config.SandboxOpts{IdleTTL: time.Hour}
+
+	ctx := sandboxContext(0)
+	sandbox, release := s.service.getSandbox(ctx)
+
+	evicted := make(chan struct{})
+	go func() {
+		s.service.evictIdle(s.clock.Now().Add(2 * time.Hour))
+		close(evicted)
+	}()
+
+	s.Eventually(func() bool {
+		s.service.mu.RLock()
+		defer s.service.mu.RUnlock()
+
+		return s.service.evicting["student-0"] != nil
+	}, time.Second, time.Millisecond)
+
+	deleted := make(chan error)
+	go func() {
+		deleted <- s.service.DeleteProductByID(ctx, s.seed[0].ID)
+	}()
+
+	select {
+	case <-evicted:
+		s.Fail("eviction must wait for the request")
+	case <-deleted:
+		s.Fail("sandbox must not be loaded again before its eviction is finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.Require().NoError(sandbox.service.DeleteProductByID(s.seed[1].ID))
+	sandbox.markUnsaved()
+	release()
+
+	select {
+	case err := <-deleted:
+		s.Require().NoError(err)
+	case <-time.After(time.Second):
+		s.Fail("request must continue after the eviction")
+	}
+
+	<-evicted
+
+	_, ok := sandbox.acquire()
+	s.False(ok, "evicted copy must not be used")
+
+	ids := s.listProductIDs(ctx)
+	s.Len(ids, seedProductsCount-2, "both changes must be kept")
+	s.NotContains(ids, s.seed[0].ID)
+	s.NotContains(ids, s.seed[1].ID)
+}
+
+func (s *ProductIsolationSuite) TestCursorIsStableBetweenChanges() {
+	ctx := sandboxContext(0)
+	filter := models.ProductFilter{Sort: models.SortByPrice, Descending: true}
+
+	first, pagination, err := s.service.GetProductsList(ctx, models.PageRequest{Page: 1, PageSize: 10}, filter)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(pagination.NextCursor)
+
+	s.Require().NoError(s.service.DeleteProductByID(ctx, first[len(first)-1].ID))
+	s.Require().NoError(s.service.DeleteProductByID(ctx, first[0].ID))
+
+	second, _, err := s.service.GetProductsList(ctx, models.PageRequest{PageSize: 10, Cursor: pagination.NextCursor}, filter)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(second)
+	s.Equal(s.seed[seedProductsCount-11].ID, second[0].ID, "deletes must not shift the next page")
+
+	_, _, err = s.service.GetProductsList(ctx, models.PageRequest{PageSize: 10, Cursor: pagination.NextCursor}, models.ProductFilter{})
+	s.ErrorIs(err, models.ErrBadRequest, "cursor must not be reused with another sort")
+}
+
+func (s *ProductIsolationSuite) TestCursorSurvivesRestore() {
+	ctx := sandboxContext(0)
+
+	for _, product := range s.seed[:5] {
+		s.Require().NoError(s.service.DeleteProductByID(ctx, product.ID))
+	}
+
+	_, pagination, err := s.service.GetProductsList(ctx, models.PageRequest{Page: 1, PageSize: 10}, models.ProductFilter{})
+	s.Require().NoError(err)
+
+	buf, err := json.Marshal(s.service.GetSandboxSnapshot(ctx))
+	s.Require().NoError(err)
+
+	var snapshot models.SandboxSnapshot
+	s.Require().NoError(json.Unmarshal(buf, &snapshot))
+
+	s.service.ResetSandbox(ctx)
+	s.service.AddProduct(ctx)
+	s.Require().NoError(s.service.RestoreSandbox(ctx, snapshot))
+
+	next, _, err := s.service.GetProductsList(ctx, models.PageRequest{PageSize: 10, Cursor: pagination.NextCursor}, models.ProductFilter{})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(next)
+	s.Equal(s.seed[15].ID, next[0].ID, "restore must not renumber products")
+
+	created := s.service.AddProduct(ctx)
+	ids := s.listProductIDs(ctx)
+	s.Equal(created.ID, ids[len(ids)-1], "new products go after restored ones")
+}
+
+// productsOf returns the product service of the caller's sandbox.
+func (s *ProductIsolationSuite) productsOf(ctx context.Context) *ProductService {
+	sandbox, release := s.service.getSandbox(ctx)
+	defer release()
+
+	return sandbox.service
+}
+
+// createOrder places an order the way the generator and the simulator do.
+func (s *ProductIsolationSuite) createOrder(products *ProductService, input models.OrderInput) (models.Order, error) {
+	products.productMutex.Lock()
+	defer products.productMutex.Unlock()
+
+	return products.createOrder(input)
+}
+
+func (s *ProductIsolationSuite) listProductIDs(ctx context.Context) []string {
+	var ids []string
+
+	pageRequest := models.PageRequest{PageSize: 7}
+
+	for {
+		products, pagination, err := s.service.GetProductsList(ctx, pageRequest, models.ProductFilter{})
+		s.Require().NoError(err)
+
+		for _, product := range products {
+			ids = append(ids, product.ID)
+		}
+
+		if pagination.NextCursor == "" {
+			return ids
+		}
+
+		pageRequest.Cursor = pagination.NextCursor
+	}
+}
+
+func pageOf(page int) models.PageRequest {
+	return models.PageRequest{Page: page, PageSize: models.DefaultPageSize}
+}
+
+func sandboxContext(sandbox int) context.Context {
+	return context.WithValue(context.Background(), models.ContextClaimsKey{}, &models.AuthTokenClaims{
+		Nickname: fmt.Sprintf("student-%d", sandbox),
+	})
+}
+
+func teacherContext() context.Context {
+	return context.WithValue(context.Background(), models.ContextClaimsKey{}, &models.AuthTokenClaims{
+		Nickname:  "teacher",
+		IsTeacher: true,
+	})
+}
+
+type manualClock struct {
+	now time.Time
+
+	mu sync.Mutex
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+type memoryStorage struct {
+	snapshots map[string]models.SandboxSnapshot
+	loads     int
+	saves     int
+
+	mu sync.Mutex
+}
+
+func (m *memoryStorage) Save(nickname string, snapshot models.SandboxSnapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.saves++
+	m.snapshots[nickname] = snapshot
+
+	return nil
+}
+
+func (m *memoryStorage) Load(nickname string) (models.SandboxSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loads++
+
+	snapshot, has := m.snapshots[nickname]
+	if !has {
+		return snapshot, models.ErrNotFound
+	}
+
+	return snapshot, nil
+}
+
+func (m *memoryStorage) List() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nicknames := make([]string, 0, len(m.snapshots))
+	for nickname := range m.snapshots {
+		nicknames = append(nicknames, nickname)
+	}
+
+	return nicknames, nil
+}
@@ -0,0 +1,387 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"seller-pages/internal/models"
+)
+
+const maxRefundReasonLength = 500
+
+var refundReasons = []string{
+	"Не подошел размер",
+	"Товар пришел с браком",
+	"Не соответствует описанию",
+	"Пришел не тот товар",
+	"Передумал покупать",
+}
+
+// listedRefund is a refund copy with its position in the sandbox refunds.
+type listedRefund struct {
+	models.Refund
+
+	sequence uint64
+}
+
+// setRefunds replaces the refunds with copies of refunds. Must be called under productMutex.
+func (s *ProductService) setRefunds(refunds []models.Refund) {
+	s.refunds = make([]*models.Refund, 0, len(refunds))
+	s.refundIndex = make(map[string]int, len(refunds))
+
+	for _, refund := range refunds {
+		s.appendRefund(refund)
+	}
+}
+
+// appendRefund adds the refund to the end of the list, refunds are never removed,
+// so the position is also the refund sequence. Must be called under productMutex.
+func (s *ProductService) appendRefund(refund models.Refund) {
+	s.refundIndex[refund.ID] = len(s.refunds)
+	s.refunds = append(s.refunds, &refund)
+}
+
+// GetRefunds returns a page of refunds matching the filter, in the filter order.
+func (s *ProductService) GetRefunds(
+	pageRequest models.PageRequest,
+	filter models.RefundFilter,
+) ([]models.Refund, models.Pagination, error) {
+	s.productMutex.RLock()
+	refunds := s.filterRefunds(filter)
+	s.productMutex.RUnlock()
+
+	order := sortOrder{Field: filter.Sort, Descending: filter.Descending}
+	sortItems(refunds, order, refundKey(filter))
+
+	page, pagination, err := paginate(refunds, pageRequest, order, refundKey(filter))
+	if err != nil {
+		return nil, pagination, err
+	}
+
+	result := make([]models.Refund, len(page))
+	for i, listed := range page {
+		result[i] = listed.Refund
+	}
+
+	return result, pagination, nil
+}
+
+func (s *ProductService) GetRefundByID(refundID string) (models.Refund, error) {
+	s.productMutex.RLock()
+	defer s.productMutex.RUnlock()
+
+	index, has := s.refundIndex[refundID]
+	if !has {
+		return models.Refund{}, fmt.Errorf("%w: refund %s not found", models.ErrNotFound, refundID)
+	}
+
+	return *s.refunds[index], nil
+}
+
+// RequestRefund files a return request of the buyer for a delivered order. An order can have only one
+// pending or approved refund, the buyer can ask again after a rejection.
+func (s *ProductService) RequestRefund(input models.RefundInput) (models.Refund, error) {
+	if err := validateRefundInput(input); err != nil {
+		return models.Refund{}, err
+	}
+
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	return s.requestRefund(input)
+}
+
+// requestRefund must be called under productMutex with a valid input.
+func (s *ProductService) requestRefund(input models.RefundInput) (models.Refund, error) {
+	index, has := s.orderIndex[input.OrderID]
+	if !has {
+		return models.Refund{}, &models.ValidationError{Fields: map[string]string{"orderId": "order not found"}}
+	}
+
+	order := s.orders[index]
+
+	if input.FeedbackID != "" && !s.isOrderFeedback(order, input.FeedbackID) {
+		return models.Refund{}, &models.ValidationError{Fields: map[string]string{
+			"feedbackId": "feedback to the order products not found",
+		}}
+	}
+
+	if order.Status != models.OrderStatusDelivered {
+		return models.Refund{}, fmt.Errorf("%w: only delivered orders can be returned, order %s is %s",
+			models.ErrConflict, order.ID, order.Status)
+	}
+
+	for _, refund := range s.refunds {
+		if refund.OrderID == order.ID && refund.Status != models.RefundStatusRejected {
+			return models.Refund{}, fmt.Errorf("%w: order %s already has the %s refund %s",
+				models.ErrConflict, order.ID, refund.Status, refund.ID)
+		}
+
+		if input.FeedbackID != "" && refund.FeedbackID == input.FeedbackID {
+			return models.Refund{}, fmt.Errorf("%w: feedback %s is linked to the refund %s",
+				models.ErrConflict, input.FeedbackID, refund.ID)
+		}
+	}
+
+	now := s.clock.Now()
+
+	refund := models.Refund{
+		ID:         uuid.NewString(),
+		OrderID:    order.ID,
+		FeedbackID: input.FeedbackID,
+		BuyerName:  order.BuyerName,
+		Amount:     order.Total,
+		Reason:     strings.TrimSpace(input.Reason),
+		Status:     models.RefundStatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	s.appendRefund(refund)
+
+	s.events.Publish(models.EventRefundRequested, refund)
+
+	return refund, nil
+}
+
+// isOrderFeedback reports whether the feedback is posted to one of the order products.
+// Must be called under productMutex.
+func (s *ProductService) isOrderFeedback(order *models.Order, feedbackID string) bool {
+	return slices.ContainsFunc(order.Items, func(item models.OrderItem) bool {
+		return s.feedbackService.HasFeedback(item.ProductID, feedbackID)
+	})
+}
+
+// ResolveRefund approves or rejects a pending refund. An approved refund refunds its order: the items
+// return to the warehouse and the balance loses the order total. The linked feedback is marked
+// as a refund one only if the refund is approved.
+func (s *ProductService) ResolveRefund(refundID string, input models.RefundResolutionInput) (models.Refund, error) {
+	if err := validateRefundResolutionInput(input); err != nil {
+		return models.Refund{}, err
+	}
+
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	index, has := s.refundIndex[refundID]
+	if !has {
+		return models.Refund{}, fmt.Errorf("%w: refund %s not found", models.ErrNotFound, refundID)
+	}
+
+	refund := *s.refunds[index]
+	if refund.Status != models.RefundStatusPending {
+		return models.Refund{}, fmt.Errorf("%w: refund %s is already %s", models.ErrConflict, refund.ID, refund.Status)
+	}
+
+	reason := strings.TrimSpace(input.Reason)
+
+	if input.Status == models.RefundStatusApproved {
+		orderIndex, has := s.orderIndex[refund.OrderID]
+		if !has {
+			return models.Refund{}, fmt.Errorf("%w: order %s of the refund not found", models.ErrConflict, refund.OrderID)
+		}
+
+		_, err := s.changeOrderStatus(orderIndex, models.OrderStatusInput{
+			Status: models.OrderStatusRefunded,
+			Reason: cmp.Or(reason, refund.Reason),
+		})
+		if err != nil {
+			return models.Refund{}, err
+		}
+	}
+
+	now := s.clock.Now()
+
+	refund.Status = input.Status
+	refund.Resolution = reason
+	refund.UpdatedAt = now
+	refund.ResolvedAt = now
+
+	s.refunds[index] = &refund
+
+	if refund.FeedbackID != "" {
+		s.feedbackService.LinkRefund(refund.FeedbackID, refund.ID, refund.Status == models.RefundStatusApproved)
+	}
+
+	s.events.Publish(models.EventRefundResolved, refund)
+
+	return refund, nil
+}
+
+// RequestRandomRefunds files return requests for delivered orders which buyers decided to return,
+// with a low rated feedback to the first product of the order. Each order is returned with the chance
+// of the highest refunds percent of its products. The order draws a fixed number, so repeated turns
+// don't add chances, but an order kept once may be returned later if the refunds percent grows.
+func (s *ProductService) RequestRandomRefunds() []models.Refund {
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	requested := make(map[string]bool, len(s.refunds))
+	for _, refund := range s.refunds {
+		requested[refund.OrderID] = true
+	}
+
+	var result []models.Refund
+
+	for _, order := range s.orders {
+		if order.Status != models.OrderStatusDelivered || requested[order.ID] || !s.wantsRefund(order) {
+			continue
+		}
+
+		input := models.RefundInput{
+			OrderID: order.ID,
+			Reason:  refundReasons[rand.Intn(len(refundReasons))],
+		}
+
+		// items of deleted products can't get feedbacks
+		if product, has := s.productIndex[order.Items[0].ProductID]; has {
+			feedback := s.feedbackService.AddRefundFeedback(*product, order.BuyerName, input.Reason)
+			input.FeedbackID = feedback.ID
+
+			s.replaceDerived(product.ID, func(updated *models.Product) {
+				setFeedbackStats(updated, s.feedbackService.Stats(product.ID))
+			})
+		}
+
+		refund, err := s.requestRefund(input)
+		if err != nil {
+			continue
+		}
+
+		result = append(result, refund)
+	}
+
+	if len(result) > 0 {
+		s.publishBalance()
+	}
+
+	return result
+}
+
+// wantsRefund must be called under productMutex.
+func (s *ProductService) wantsRefund(order *models.Order) bool {
+	var refundsPercent float64
+
+	for _, item := range order.Items {
+		if product, has := s.productIndex[item.ProductID]; has {
+			refundsPercent = max(refundsPercent, product.RefundsPercent)
+		}
+	}
+
+	return hashFraction("refund"+order.ID)*100 < refundsPercent
+}
+
+// filterRefunds returns copies of refunds matching the filter. Must be called under productMutex.
+func (s *ProductService) filterRefunds(filter models.RefundFilter) []listedRefund {
+	result := make([]listedRefund, 0, len(s.refunds))
+
+	for i, refund := range s.refunds {
+		if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, refund.Status) {
+			continue
+		}
+
+		if filter.OrderID != "" && refund.OrderID != filter.OrderID {
+			continue
+		}
+
+		result = append(result, listedRefund{
+			Refund:   *refund,
+			sequence: uint64(i + 1),
+		})
+	}
+
+	return result
+}
+
+// refundKey returns the position of the refund in a list sorted by the filter field.
+func refundKey(filter models.RefundFilter) func(refund listedRefund) sortKey {
+	return func(refund listedRefund) sortKey {
+		key := sortKey{Sequence: refund.sequence}
+
+		switch filter.Sort {
+		case models.SortByCreatedAt:
+			key.Number = float64(refund.CreatedAt.UnixMicro())
+		case models.SortByAmount:
+			key.Number = refund.Amount
+		}
+
+		return key
+	}
+}
+
+func validateRefundInput(input models.RefundInput) error {
+	fields := make(map[string]string)
+
+	if input.OrderID == "" {
+		fields["orderId"] = "must not be empty"
+	}
+
+	if strings.TrimSpace(input.Reason) == "" {
+		fields["reason"] = "must not be empty"
+	} else if utf8.RuneCountInString(input.Reason) > maxRefundReasonLength {
+		fields["reason"] = fmt.Sprintf("must be at most %d characters", maxRefundReasonLength)
+	}
+
+	if len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+func validateRefundResolutionInput(input models.RefundResolutionInput) error {
+	fields := make(map[string]string)
+
+	if input.Status != models.RefundStatusApproved && input.Status != models.RefundStatusRejected {
+		fields["status"] = fmt.Sprintf("must be one of: %s, %s", models.RefundStatusApproved, models.RefundStatusRejected)
+	}
+
+	switch {
+	case utf8.RuneCountInString(input.Reason) > maxRefundReasonLength:
+		fields["reason"] = fmt.Sprintf("must be at most %d characters", maxRefundReasonLength)
+	case input.Status == models.RefundStatusRejected && strings.TrimSpace(input.Reason) == "":
+		fields["reason"] = "must not be empty to reject"
+	}
+
+	if len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+// validateSnapshotRefunds checks refunds of a snapshot, they must refer to its orders.
+func validateSnapshotRefunds(refunds []models.Refund, orders []models.Order, fields map[string]string) {
+	orderIDs := make(map[string]struct{}, len(orders))
+	for _, order := range orders {
+		orderIDs[order.ID] = struct{}{}
+	}
+
+	ids := make(map[string]struct{}, len(refunds))
+
+	for i, refund := range refunds {
+		prefix := fmt.Sprintf("refunds[%d]", i)
+
+		if refund.ID == "" {
+			fields[prefix+".id"] = "must not be empty"
+		} else if _, has := ids[refund.ID]; has {
+			fields[prefix+".id"] = "must be unique"
+		}
+
+		ids[refund.ID] = struct{}{}
+
+		if !slices.Contains(models.RefundStatuses, refund.Status) {
+			fields[prefix+".status"] = "must be one of: " + strings.Join(models.RefundStatuses, ", ")
+		}
+
+		if _, has := orderIDs[refund.OrderID]; !has {
+			fields[prefix+".orderId"] = "order not found"
+		}
+	}
+}
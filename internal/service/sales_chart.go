@@ -0,0 +1,139 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"seller-pages/internal/models"
+)
+
+const maxChartPoints = 400
+
+var (
+	// defaultChartPoints is the number of periods up to now shown when the range start isn't given.
+	defaultChartPoints = map[string]int{
+		models.GranularityDay:   30,
+		models.GranularityWeek:  12,
+		models.GranularityMonth: 5,
+	}
+
+	monthNames = [...]string{
+		"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+		"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь",
+	}
+	monthNamesGenitive = [...]string{
+		"января", "февраля", "марта", "апреля", "мая", "июня",
+		"июля", "августа", "сентября", "октября", "ноября", "декабря",
+	}
+)
+
+// chartPeriod is a chart point range [from, to).
+type chartPeriod struct {
+	from time.Time
+	to   time.Time
+}
+
+// chartPeriods splits the requested range into whole days, weeks or months, newest first.
+// Weeks start on Monday, the first and the last periods are extended to whole ones.
+func chartPeriods(query models.ChartQuery, now time.Time) ([]chartPeriod, error) {
+	granularity := query.Granularity
+	if _, known := defaultChartPoints[granularity]; !known {
+		return nil, fmt.Errorf("%w: unknown chart granularity %q", models.ErrBadRequest, granularity)
+	}
+
+	to := now
+	if query.To != nil {
+		to = query.To.In(now.Location())
+	}
+
+	var from time.Time
+
+	if query.From != nil {
+		from = periodStart(query.From.In(now.Location()), granularity)
+	} else {
+		from = periodStart(to, granularity)
+		for range defaultChartPoints[granularity] - 1 {
+			from = periodStart(from.AddDate(0, 0, -1), granularity)
+		}
+	}
+
+	if from.After(to) {
+		return nil, fmt.Errorf("%w: from must not be after to", models.ErrBadRequest)
+	}
+
+	var periods []chartPeriod
+
+	for start := from; !start.After(to); start = nextPeriodStart(start, granularity) {
+		if len(periods) == maxChartPoints {
+			return nil, fmt.Errorf("%w: chart must have at most %d points, use a shorter range or a larger granularity",
+				models.ErrBadRequest, maxChartPoints)
+		}
+
+		periods = append(periods, chartPeriod{from: start, to: nextPeriodStart(start, granularity)})
+	}
+
+	slices.Reverse(periods)
+
+	return periods, nil
+}
+
+// periodStart returns the start of the day, week or month containing moment.
+func periodStart(moment time.Time, granularity string) time.Time {
+	day := time.Date(moment.Year(), moment.Month(), moment.Day(), 0, 0, 0, 0, moment.Location())
+
+	switch granularity {
+	case models.GranularityDay:
+		return day
+	case models.GranularityWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	default:
+		return time.Date(moment.Year(), moment.Month(), 1, 0, 0, 0, 0, moment.Location())
+	}
+}
+
+func nextPeriodStart(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case models.GranularityDay:
+		return start.AddDate(0, 0, 1)
+	case models.GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// salePoint describes the period with ISO dates and a Russian label, the year is added if it isn't the current one.
+func salePoint(period chartPeriod, amount float64, granularity string, now time.Time) models.SalePoint {
+	last := period.to.AddDate(0, 0, -1)
+
+	var label string
+
+	switch granularity {
+	case models.GranularityDay:
+		label = dayLabel(period.from)
+	case models.GranularityWeek:
+		if period.from.Month() == last.Month() {
+			label = fmt.Sprintf("%d–%s", period.from.Day(), dayLabel(last))
+		} else {
+			label = dayLabel(period.from) + " – " + dayLabel(last)
+		}
+	default:
+		label = monthNames[period.from.Month()-1]
+	}
+
+	if last.Year() != now.Year() {
+		label = fmt.Sprintf("%s %d", label, last.Year())
+	}
+
+	return models.SalePoint{
+		Amount: roundMoney(amount),
+		Period: label,
+		From:   period.from.Format(time.DateOnly),
+		To:     last.Format(time.DateOnly),
+	}
+}
+
+func dayLabel(day time.Time) string {
+	return fmt.Sprintf("%d %s", day.Day(), monthNamesGenitive[day.Month()-1])
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"seller-pages/internal/models"
+)
+
+type sandbox struct {
+	nickname  string
+	service   *ProductService
+	clock     Clock
+	createdAt time.Time
+
+	lastActivity atomic.Int64
+	// unsaved is set when the sandbox changed or the last save failed, it must be saved before eviction.
+	unsaved atomic.Bool
+	// stored is set when the storage has a state of the sandbox, only such sandboxes are listed after eviction.
+	stored    atomic.Bool
+	persistMu sync.Mutex
+
+	feedbackSimulator simulator
+	orderSimulator    simulator
+
+	// lifecycle is held for reading while the sandbox is used and for writing by its eviction,
+	// so a sandbox is never evicted in the middle of a request.
+	lifecycle sync.RWMutex
+	// evicted is set under lifecycle when the sandbox leaves memory, its copy must not be used after that.
+	evicted bool
+	// evictedCh is closed when the eviction is finished and the sandbox can be loaded again.
+	evictedCh chan struct{}
+}
+
+func newSandbox(nickname string, service *ProductService, clock Clock, createdAt time.Time) *sandbox {
+	result := &sandbox{
+		nickname:  nickname,
+		service:   service,
+		clock:     clock,
+		createdAt: createdAt,
+		evictedCh: make(chan struct{}),
+	}
+	result.touch()
+
+	return result
+}
+
+func (s *sandbox) touch() {
+	s.lastActivity.Store(s.clock.Now().UnixNano())
+}
+
+// markUnsaved schedules saving of the changed sandbox, it's cheap enough to call after every change.
+func (s *sandbox) markUnsaved() {
+	s.unsaved.Store(true)
+}
+
+func (s *sandbox) lastActivityAt() time.Time {
+	return time.Unix(0, s.lastActivity.Load())
+}
+
+// acquire holds the sandbox in memory until the returned release is called.
+// It fails if the sandbox has already been evicted.
+func (s *sandbox) acquire() (release func(), ok bool) {
+	s.lifecycle.RLock()
+
+	if s.evicted {
+		s.lifecycle.RUnlock()
+
+		return nil, false
+	}
+
+	return s.lifecycle.RUnlock, true
+}
+
+// info returns stats of the sandbox for teachers.
+func (s *sandbox) info() models.SandboxInfo {
+	productsCount, feedbacksCount := s.service.Counts()
+
+	return models.SandboxInfo{
+		Nickname:       s.nickname,
+		ProductsCount:  productsCount,
+		FeedbacksCount: feedbacksCount,
+		CreatedAt:      s.createdAt,
+		LastActivityAt: s.lastActivityAt(),
+		IsLoaded:       true,
+	}
+}
+
+func (s *sandbox) snapshot() models.SandboxSnapshot {
+	snapshot := s.service.Snapshot()
+	snapshot.CreatedAt = s.createdAt
+	snapshot.LastActivityAt = s.lastActivityAt()
+
+	return snapshot
+}
+
+// RunJanitor evicts idle sandboxes and saves changed ones every interval until ctx is done,
+// then saves the changed sandboxes left.
+func (s *ProductIsolationService) RunJanitor(ctx context.Context) {
+	// a nil channel never fires, so disabled intervals just skip their work
+	var evictTicks, saveTicks <-chan time.Time
+
+	if s.limits.JanitorInterval > 0 {
+		ticker := time.NewTicker(s.limits.JanitorInterval)
+		defer ticker.Stop()
+
+		evictTicks = ticker.C
+	}
+
+	if s.limits.SaveInterval > 0 {
+		ticker := time.NewTicker(s.limits.SaveInterval)
+		defer ticker.Stop()
+
+		saveTicks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.flushUnsaved()
+
+			return
+		case <-evictTicks:
+			s.evictIdle(s.clock.Now())
+		case <-saveTicks:
+			s.flushUnsaved()
+		}
+	}
+}
+
+func (s *ProductIsolationService) evictIdle(now time.Time) {
+	if s.limits.IdleTTL <= 0 {
+		return
+	}
+
+	var victims []*sandbox
+
+	s.mu.Lock()
+	for _, existing := range s.services {
+		if now.Sub(existing.lastActivityAt()) > s.limits.IdleTTL {
+			victims = append(victims, s.startEviction(existing))
+		}
+	}
+	s.mu.Unlock()
+
+	s.finishEvictions(victims)
+}
+
+// evictOverflow starts eviction of least recently used sandboxes above the limit and returns them,
+// the caller must finish their eviction after releasing mu. Must be called under mu.
+func (s *ProductIsolationService) evictOverflow() []*sandbox {
+	var victims []*sandbox
+
+	for s.limits.MaxCount > 0 && len(s.services) > s.limits.MaxCount {
+		var victim *sandbox
+
+		for _, existing := range s.services {
+			if victim == nil || existing.lastActivityAt().Before(victim.lastActivityAt()) {
+				victim = existing
+			}
+		}
+
+		victims = append(victims, s.startEviction(victim))
+	}
+
+	return victims
+}
+
+// startEviction removes the sandbox from the loaded ones. Until the eviction is finished,
+// the sandbox can't be loaded again, so its last state is never lost. Must be called under mu.
+func (s *ProductIsolationService) startEviction(victim *sandbox) *sandbox {
+	delete(s.services, victim.nickname)
+	s.evicting[victim.nickname] = victim
+
+	return victim
+}
+
+// finishEvictions waits for requests using the sandboxes, saves their unsaved changes
+// and keeps their stats. It does I/O, so it must be called without mu.
+func (s *ProductIsolationService) finishEvictions(victims []*sandbox) {
+	for _, victim := range victims {
+		victim.lifecycle.Lock()
+		victim.evicted = true
+
+		if victim.unsaved.Load() {
+			s.persist(victim)
+		}
+
+		info := victim.info()
+		info.IsLoaded = false
+		victim.lifecycle.Unlock()
+
+		s.mu.Lock()
+		delete(s.evicting, victim.nickname)
+		s.evictions++
+
+		// sandboxes which were never saved are lost, they start from the seed again
+		if victim.stored.Load() {
+			s.evictedInfo[victim.nickname] = info
+		}
+		s.mu.Unlock()
+
+		// before the sandbox can be loaded again, so a new load holds the stream anew
+		s.events.Release(victim.nickname)
+		close(victim.evictedCh)
+
+		s.logger.Infof("Sandbox with nickname %s evicted, last activity at %s", victim.nickname, info.LastActivityAt)
+	}
+}
+
+// flushUnsaved saves loaded sandboxes changed since their last save.
+func (s *ProductIsolationService) flushUnsaved() {
+	s.mu.RLock()
+	unsaved := make([]*sandbox, 0)
+	for _, existing := range s.services {
+		if existing.unsaved.Load() {
+			unsaved = append(unsaved, existing)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, existing := range unsaved {
+		s.persist(existing)
+	}
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	defaultSimulatorInterval = 30 * time.Second
+	minSimulatorInterval     = time.Second
+	maxSimulatorInterval     = time.Hour
+)
+
+// simulator keeps settings of a feedback or order simulator of a sandbox. Settings live only in memory,
+// so the simulator stops when the sandbox is evicted to fit the sandboxes limit or the server restarts.
+// Simulated turns keep the sandbox from being evicted as idle.
+type simulator struct {
+	enabled  bool
+	interval time.Duration
+	nextAt   time.Time
+
+	mu sync.Mutex
+}
+
+// due reports whether it's time for the next simulated event and schedules the one after it.
+func (s *simulator) due(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.enabled || now.Before(s.nextAt) {
+		return false
+	}
+
+	s.nextAt = s.nextAt.Add(s.interval)
+	// after a long pause events are not simulated in a burst to catch up
+	if s.nextAt.Before(now) {
+		s.nextAt = now.Add(s.interval)
+	}
+
+	return true
+}
+
+func (s *simulator) settings(defaultInterval time.Duration) models.SimulatorSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	interval := s.interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+
+	return models.SimulatorSettings{
+		Enabled:         s.enabled,
+		IntervalSeconds: int(interval / time.Second),
+	}
+}
+
+func (s *simulator) set(enabled bool, interval time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enabled = enabled
+	s.interval = interval
+	s.nextAt = now.Add(interval)
+}
+
+func (s *ProductIsolationService) GetFeedbackSimulator(ctx context.Context) models.SimulatorSettings {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.feedbackSimulator.settings(s.defaultSimulatorInterval())
+}
+
+// SetFeedbackSimulator switches posting of random feedbacks to random products of the caller's sandbox.
+func (s *ProductIsolationService) SetFeedbackSimulator(
+	ctx context.Context,
+	settings models.SimulatorSettings,
+) (models.SimulatorSettings, error) {
+	return s.setSimulator(ctx, "Feedback", settings, func(sandbox *sandbox) *simulator {
+		return &sandbox.feedbackSimulator
+	})
+}
+
+func (s *ProductIsolationService) GetOrderSimulator(ctx context.Context) models.SimulatorSettings {
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	return sandbox.orderSimulator.settings(s.defaultSimulatorInterval())
+}
+
+// SetOrderSimulator switches placing of random orders in the caller's sandbox. On the same turns
+// buyers ask to return delivered orders in the refunds percent of their products.
+func (s *ProductIsolationService) SetOrderSimulator(
+	ctx context.Context,
+	settings models.SimulatorSettings,
+) (models.SimulatorSettings, error) {
+	return s.setSimulator(ctx, "Order", settings, func(sandbox *sandbox) *simulator {
+		return &sandbox.orderSimulator
+	})
+}
+
+func (s *ProductIsolationService) setSimulator(
+	ctx context.Context,
+	name string,
+	settings models.SimulatorSettings,
+	simulatorOf func(sandbox *sandbox) *simulator,
+) (models.SimulatorSettings, error) {
+	interval := time.Duration(settings.IntervalSeconds) * time.Second
+	if interval == 0 {
+		interval = s.defaultSimulatorInterval()
+	}
+
+	if interval < minSimulatorInterval || interval > maxSimulatorInterval {
+		return models.SimulatorSettings{}, &models.ValidationError{Fields: map[string]string{
+			"intervalSeconds": fmt.Sprintf("must be from %d to %d", minSimulatorInterval/time.Second, maxSimulatorInterval/time.Second),
+		}}
+	}
+
+	sandbox, release := s.getSandbox(ctx)
+	defer release()
+
+	simulator := simulatorOf(sandbox)
+	simulator.set(settings.Enabled, interval, s.clock.Now())
+
+	s.logger.Infof("%s simulator of sandbox with nickname %s set to %+v", name, sandbox.nickname, settings)
+
+	return simulator.settings(interval), nil
+}
+
+func (s *ProductIsolationService) defaultSimulatorInterval() time.Duration {
+	if s.limits.SimulatorDefaultInterval > 0 {
+		return s.limits.SimulatorDefaultInterval
+	}
+
+	return defaultSimulatorInterval
+}
+
+// RunSimulator posts feedbacks and places orders in sandboxes with enabled simulators every tick until ctx is done.
+func (s *ProductIsolationService) RunSimulator(ctx context.Context) {
+	if s.limits.SimulatorTick <= 0 {
+		<-ctx.Done()
+
+		return
+	}
+
+	ticker := time.NewTicker(s.limits.SimulatorTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.simulate(s.clock.Now())
+		}
+	}
+}
+
+// simulate posts a feedback and places an order in every loaded sandbox whose simulators are due.
+// Simulated turns are not activity of the owner, so an idle sandbox is evicted with its simulators.
+func (s *ProductIsolationService) simulate(now time.Time) {
+	s.mu.RLock()
+	loaded := make([]*sandbox, 0, len(s.services))
+	for _, existing := range s.services {
+		loaded = append(loaded, existing)
+	}
+	s.mu.RUnlock()
+
+	for _, existing := range loaded {
+		s.simulateTurn(existing, now)
+	}
+}
+
+// simulateTurn runs due simulators of the sandbox. Sandboxes evicted since they were listed are skipped.
+func (s *ProductIsolationService) simulateTurn(sandbox *sandbox, now time.Time) {
+	release, ok := sandbox.acquire()
+	if !ok {
+		return
+	}
+	defer release()
+
+	feedback := sandbox.feedbackSimulator.due(now)
+	order := sandbox.orderSimulator.due(now)
+
+	if !feedback && !order {
+		return
+	}
+
+	changed := false
+
+	// sandboxes without products or stock just skip the turn
+	if feedback {
+		_, err := sandbox.service.AddRandomFeedback()
+		changed = err == nil
+	}
+
+	if order {
+		if _, err := sandbox.service.AddRandomOrder(); err == nil {
+			changed = true
+		}
+
+		if len(sandbox.service.RequestRandomRefunds()) > 0 {
+			changed = true
+		}
+	}
+
+	if changed {
+		sandbox.markUnsaved()
+	}
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	maxStockReasonLength = 500
+	// maxStockMovements is how many latest entries of each product journal are kept.
+	maxStockMovements = 500
+
+	initialStockReason = "Начальный остаток"
+)
+
+// setStockMovements replaces the stock journals with movements grouped by product.
+// The seed has no movements, so every movement keeps its stored sequence. Must be called under productMutex.
+func (s *ProductService) setStockMovements(movements []models.StockMovement) {
+	s.stockMovements = make(map[string][]models.StockMovement)
+
+	for _, movement := range movements {
+		s.appendStockMovement(movement)
+	}
+}
+
+// appendStockMovement adds the movement to the product journal and drops the oldest entries
+// above maxStockMovements. Must be called under productMutex.
+func (s *ProductService) appendStockMovement(movement models.StockMovement) {
+	journal := append(s.stockMovements[movement.ProductID], movement)
+	if len(journal) > maxStockMovements {
+		journal = slices.Clone(journal[len(journal)-maxStockMovements:])
+	}
+
+	s.stockMovements[movement.ProductID] = journal
+}
+
+func lastStockSequence(journal []models.StockMovement) uint64 {
+	if len(journal) == 0 {
+		return 0
+	}
+
+	return journal[len(journal)-1].Sequence
+}
+
+// moveStock changes the warehouse quantity of the product by the movement quantity, along with other
+// derived data changed by the same event, and journals the movement. Missing products are skipped.
+// Must be called under productMutex.
+func (s *ProductService) moveStock(
+	productID string,
+	movement models.StockMovement,
+	change func(product *models.Product),
+) (models.StockMovement, bool) {
+	s.replaceDerived(productID, func(product *models.Product) {
+		product.WarehouseQuantity += movement.Quantity
+
+		if change != nil {
+			change(product)
+		}
+	})
+
+	product, has := s.productIndex[productID]
+	if !has {
+		return models.StockMovement{}, false
+	}
+
+	return s.journalStock(product, movement), true
+}
+
+// journalStock records the movement already applied to the product and warns when the product
+// gets low on stock. Must be called under productMutex.
+func (s *ProductService) journalStock(product *models.Product, movement models.StockMovement) models.StockMovement {
+	movement.ID = uuid.NewString()
+	movement.ProductID = product.ID
+	movement.Sequence = lastStockSequence(s.stockMovements[product.ID]) + 1
+	movement.QuantityAfter = product.WarehouseQuantity
+	movement.CreatedAt = s.clock.Now()
+
+	s.appendStockMovement(movement)
+
+	wasLow := product.LowStockThreshold > 0 && movement.QuantityAfter-movement.Quantity <= product.LowStockThreshold
+	if isLowStock(product) && !wasLow {
+		s.events.Publish(models.EventProductLowStock, product.ToPageInfo())
+	}
+
+	return movement
+}
+
+func isLowStock(product *models.Product) bool {
+	return product.LowStockThreshold > 0 && product.WarehouseQuantity <= product.LowStockThreshold
+}
+
+// AdjustStock receives, writes off or corrects the product stock by hand. A correction sets
+// the warehouse quantity to the counted one. Stock can't be written off below zero.
+func (s *ProductService) AdjustStock(productID string, input models.StockAdjustmentInput) (models.StockMovement, error) {
+	if err := validateStockAdjustmentInput(input); err != nil {
+		return models.StockMovement{}, err
+	}
+
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	product, has := s.productIndex[productID]
+	if !has {
+		return models.StockMovement{}, fmt.Errorf("%w: product %s not found", models.ErrNotFound, productID)
+	}
+
+	movement := models.StockMovement{
+		Type:   input.Type,
+		Reason: strings.TrimSpace(input.Reason),
+	}
+
+	switch input.Type {
+	case models.StockMovementReceipt:
+		movement.Quantity = input.Quantity
+	case models.StockMovementWriteOff:
+		if input.Quantity > product.WarehouseQuantity {
+			return models.StockMovement{}, fmt.Errorf("%w: only %d of product %s left in stock",
+				models.ErrConflict, product.WarehouseQuantity, product.ID)
+		}
+
+		movement.Quantity = -input.Quantity
+	case models.StockMovementCorrection:
+		movement.Quantity = input.Quantity - product.WarehouseQuantity
+	}
+
+	result, _ := s.moveStock(productID, movement, nil)
+
+	return result, nil
+}
+
+// GetStockMovements returns a page of the product stock journal matching the filter, in the filter order.
+func (s *ProductService) GetStockMovements(
+	productID string,
+	pageRequest models.PageRequest,
+	filter models.StockMovementFilter,
+) ([]models.StockMovement, models.Pagination, error) {
+	s.productMutex.RLock()
+
+	if _, has := s.productIndex[productID]; !has {
+		s.productMutex.RUnlock()
+
+		return nil, models.Pagination{}, fmt.Errorf("%w: product %s not found", models.ErrNotFound, productID)
+	}
+
+	movements := s.filterStockMovements(productID, filter)
+	s.productMutex.RUnlock()
+
+	order := sortOrder{Field: filter.Sort, Descending: filter.Descending}
+	sortItems(movements, order, stockMovementKey(filter))
+
+	return paginate(movements, pageRequest, order, stockMovementKey(filter))
+}
+
+// SetLowStockThreshold changes the warehouse quantity at which the product is low on stock.
+// The product gets the low stock event only when a movement brings it down to the threshold.
+func (s *ProductService) SetLowStockThreshold(
+	productID string,
+	input models.LowStockThresholdInput,
+) (models.ProductPageInfo, error) {
+	if input.LowStockThreshold < 0 {
+		return models.ProductPageInfo{}, &models.ValidationError{Fields: map[string]string{
+			"lowStockThreshold": "must not be negative",
+		}}
+	}
+
+	s.productMutex.Lock()
+	defer s.productMutex.Unlock()
+
+	if _, has := s.productIndex[productID]; !has {
+		return models.ProductPageInfo{}, fmt.Errorf("%w: product %s not found", models.ErrNotFound, productID)
+	}
+
+	s.replaceDerived(productID, func(product *models.Product) {
+		product.LowStockThreshold = input.LowStockThreshold
+	})
+
+	return s.productIndex[productID].ToPageInfo(), nil
+}
+
+// GetLowStockProducts returns products with a threshold which have no more than it in stock,
+// the ones with the least stock first.
+func (s *ProductService) GetLowStockProducts() []models.ProductPageInfo {
+	s.productMutex.RLock()
+	defer s.productMutex.RUnlock()
+
+	result := make([]models.ProductPageInfo, 0)
+
+	for _, product := range s.products {
+		if isLowStock(product) {
+			result = append(result, product.ToPageInfo())
+		}
+	}
+
+	slices.SortStableFunc(result, func(a, b models.ProductPageInfo) int {
+		return a.WarehouseQuantity - b.WarehouseQuantity
+	})
+
+	return result
+}
+
+// filterStockMovements returns movements of the product matching the filter. Must be called under productMutex.
+func (s *ProductService) filterStockMovements(productID string, filter models.StockMovementFilter) []models.StockMovement {
+	movements := s.stockMovements[productID]
+	result := make([]models.StockMovement, 0, len(movements))
+
+	for _, movement := range movements {
+		if len(filter.Types) > 0 && !slices.Contains(filter.Types, movement.Type) {
+			continue
+		}
+
+		result = append(result, movement)
+	}
+
+	return result
+}
+
+// stockMovementKey returns the position of the movement in a journal sorted by the filter field.
+func stockMovementKey(filter models.StockMovementFilter) func(movement models.StockMovement) sortKey {
+	return func(movement models.StockMovement) sortKey {
+		key := sortKey{Sequence: movement.Sequence}
+
+		if filter.Sort == models.SortByCreatedAt {
+			key.Number = float64(movement.CreatedAt.UnixMicro())
+		}
+
+		return key
+	}
+}
+
+func validateStockAdjustmentInput(input models.StockAdjustmentInput) error {
+	fields := make(map[string]string)
+
+	switch input.Type {
+	case models.StockMovementReceipt, models.StockMovementWriteOff:
+		if input.Quantity <= 0 {
+			fields["quantity"] = "must be positive"
+		}
+	case models.StockMovementCorrection:
+		if input.Quantity < 0 {
+			fields["quantity"] = "must not be negative"
+		}
+	default:
+		fields["type"] = "must be one of: " + strings.Join(models.StockAdjustmentTypes, ", ")
+	}
+
+	if strings.TrimSpace(input.Reason) == "" {
+		fields["reason"] = "must not be empty"
+	} else if utf8.RuneCountInString(input.Reason) > maxStockReasonLength {
+		fields["reason"] = fmt.Sprintf("must be at most %d characters", maxStockReasonLength)
+	}
+
+	if len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+// validateSnapshotStockMovements checks stock journals of a snapshot, they must refer to its products.
+// Sequences must be positive and grow within each product journal.
+func validateSnapshotStockMovements(
+	movements []models.StockMovement,
+	productIDs map[string]struct{},
+	fields map[string]string,
+) {
+	ids := make(map[string]struct{}, len(movements))
+	lastSequences := make(map[string]uint64)
+
+	for i, movement := range movements {
+		prefix := fmt.Sprintf("stockMovements[%d]", i)
+
+		if movement.ID == "" {
+			fields[prefix+".id"] = "must not be empty"
+		} else if _, has := ids[movement.ID]; has {
+			fields[prefix+".id"] = "must be unique"
+		}
+
+		ids[movement.ID] = struct{}{}
+
+		if !slices.Contains(models.StockMovementTypes, movement.Type) {
+			fields[prefix+".type"] = "must be one of: " + strings.Join(models.StockMovementTypes, ", ")
+		}
+
+		if _, has := productIDs[movement.ProductID]; !has {
+			fields[prefix+".productId"] = "product not found"
+		}
+
+		if movement.Sequence <= lastSequences[movement.ProductID] {
+			fields[prefix+".sequence"] = "must be positive and grow within the product journal"
+		}
+
+		lastSequences[movement.ProductID] = movement.Sequence
+	}
+}
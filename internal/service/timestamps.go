@@ -0,0 +1,68 @@
+package service
+
+import (
+	"hash/fnv"
+	"time"
+
+	"seller-pages/internal/models"
+)
+
+const maxSeedProductAge = 365 * 24 * time.Hour
+
+// seedDatesAnchor is the fixed instant generated dates are counted back from,
+// it must not change, or dates of the same data change with it.
+var seedDatesAnchor = time.Date(2025, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+// fillTimestamps generates plausible dates for products and feedbacks saved without them:
+// products are created within the year before seedDatesAnchor, feedbacks between the product creation
+// and the anchor. Dates depend only on ids, so the same data gets the same dates after restarts.
+// A clock before the anchor is used instead of it, so dates are never in the future.
+// Products and feedbacks of the snapshot are changed in place.
+func fillTimestamps(snapshot models.SandboxSnapshot, now time.Time) {
+	anchor := seedDatesAnchor
+	if now.Before(anchor) {
+		anchor = now.Truncate(time.Second)
+	}
+
+	for i := range snapshot.Products {
+		product := &snapshot.Products[i]
+
+		if product.CreatedAt.IsZero() {
+			product.CreatedAt = anchor.Add(-hashDuration(product.ID, maxSeedProductAge))
+		}
+
+		if product.UpdatedAt.IsZero() {
+			product.UpdatedAt = product.CreatedAt.Add(hashDuration("updated"+product.ID, anchor.Sub(product.CreatedAt)))
+		}
+
+		for _, id := range snapshot.FeedbacksPerProduct[product.ID] {
+			feedback := snapshot.Feedbacks[id]
+			if feedback == nil || !feedback.CreatedAt.IsZero() {
+				continue
+			}
+
+			feedback.CreatedAt = product.CreatedAt.Add(hashDuration(feedback.ID, anchor.Sub(product.CreatedAt)))
+			feedback.UpdatedAt = feedback.CreatedAt
+		}
+	}
+}
+
+// hashDuration maps the key to a whole number of seconds from 0 up to limit.
+func hashDuration(key string, limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+
+	return time.Duration(hash.Sum64() % uint64(limit)).Truncate(time.Second)
+}
+
+// hashFraction maps the key to a number from 0 up to 1.
+func hashFraction(key string) float64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+
+	return float64(hash.Sum64()>>11) / (1 << 53)
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"seller-pages/internal/models"
+)
+
+const (
+	snapshotExtension = ".json"
+	// maxHeaderSize bounds what List reads from every file to find the nickname.
+	maxHeaderSize = 64 << 10
+)
+
+// FileStorage keeps every sandbox as a JSON snapshot file inside a directory. Files are named
+// by the nickname hash, so long nicknames fit the file name limit, and keep the nickname inside.
+type FileStorage struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create sandboxes directory: %w", err)
+	}
+
+	return &FileStorage{
+		dir: dir,
+	}, nil
+}
+
+// storedSandbox is the content of a sandbox file. The nickname must stay the first field,
+// List reads only it.
+type storedSandbox struct {
+	Nickname string                 `json:"nickname"`
+	Snapshot models.SandboxSnapshot `json:"snapshot"`
+}
+
+// Save atomically replaces the snapshot of the sandbox.
+func (s *FileStorage) Save(nickname string, snapshot models.SandboxSnapshot) error {
+	buf, err := json.Marshal(storedSandbox{Nickname: nickname, Snapshot: snapshot})
+	if err != nil {
+		return fmt.Errorf("can't marshal snapshot: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.CreateTemp(s.dir, "sandbox-*.tmp")
+	if err != nil {
+		return fmt.Errorf("can't create temp file: %w", err)
+	}
+
+	tmpName := file.Name()
+
+	_, err = file.Write(buf)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpName)
+
+		return fmt.Errorf("can't write snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmpName, s.path(nickname)); err != nil {
+		_ = os.Remove(tmpName)
+
+		return fmt.Errorf("can't replace snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStorage) Load(nickname string) (models.SandboxSnapshot, error) {
+	var stored storedSandbox
+
+	buf, err := os.ReadFile(s.path(nickname))
+	if errors.Is(err, os.ErrNotExist) {
+		return stored.Snapshot, fmt.Errorf("%w: sandbox %s is not saved", models.ErrNotFound, nickname)
+	}
+
+	if err != nil {
+		return stored.Snapshot, fmt.Errorf("can't read snapshot: %w", err)
+	}
+
+	if err := json.Unmarshal(buf, &stored); err != nil {
+		return stored.Snapshot, fmt.Errorf("can't parse snapshot: %w", err)
+	}
+
+	return stored.Snapshot, nil
+}
+
+// List returns nicknames of all saved sandboxes. Files which can't be read are skipped.
+func (s *FileStorage) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read sandboxes directory: %w", err)
+	}
+
+	nicknames := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), snapshotExtension) {
+			continue
+		}
+
+		if nickname, ok := s.nickname(entry.Name()); ok {
+			nicknames = append(nicknames, nickname)
+		}
+	}
+
+	return nicknames, nil
+}
+
+// nickname reads the nickname stored in the sandbox file. The nickname is the first field
+// of the file, so only its beginning is read instead of the whole snapshot.
+func (s *FileStorage) nickname(fileName string) (string, bool) {
+	file, err := os.Open(filepath.Join(s.dir, fileName))
+	if err != nil {
+		return "", false
+	}
+	defer func() { _ = file.Close() }()
+
+	decoder := json.NewDecoder(io.LimitReader(file, maxHeaderSize))
+
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return "", false
+	}
+
+	if token, err := decoder.Token(); err != nil || token != "nickname" {
+		return "", false
+	}
+
+	var nickname string
+	if err := decoder.Decode(&nickname); err != nil || nickname == "" {
+		return "", false
+	}
+
+	return nickname, true
+}
+
+// path hashes the nickname, so any nickname gives a safe file name of a fixed length.
+func (s *FileStorage) path(nickname string) string {
+	hash := sha256.Sum256([]byte(nickname))
+
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:])+snapshotExtension)
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"seller-pages/internal/models"
+)
+
+type FileStorageSuite struct {
+	suite.Suite
+
+	dir     string
+	storage *FileStorage
+}
+
+func TestFileStorage(t *testing.T) {
+	suite.Run(t, &FileStorageSuite{})
+}
+
+func (s *FileStorageSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+
+	storage, err := NewFileStorage(s.dir)
+	s.Require().NoError(err)
+
+	s.storage = storage
+}
+
+func (s *FileStorageSuite) TestSaveReplacesSnapshot() {
+	s.Require().NoError(s.storage.Save("student", snapshotOf("first")))
+	s.Require().NoError(s.storage.Save("student", snapshotOf("second")))
+
+	loaded, err := s.storage.Load("student")
+	s.Require().NoError(err)
+	s.Equal(snapshotOf("second"), loaded)
+
+	s.Equal([]string{filepath.Base(s.storage.path("student"))}, s.fileNames(), "temp files must be renamed or removed")
+}
+
+func (s *FileStorageSuite) TestFailedSaveRemovesTempFile() {
+	// a non-empty directory in place of the snapshot makes the rename fail
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.storage.path("student"), "dir"), 0o700))
+
+	s.Error(s.storage.Save("student", snapshotOf("first")))
+	s.Equal([]string{filepath.Base(s.storage.path("student"))}, s.fileNames())
+}
+
+func (s *FileStorageSuite) TestLoadUnsaved() {
+	_, err := s.storage.Load("student")
+	s.ErrorIs(err, models.ErrNotFound)
+}
+
+func (s *FileStorageSuite) TestLongNicknames() {
+	nickname := strings.Repeat("никнейм", 50)
+
+	s.Require().NoError(s.storage.Save(nickname, snapshotOf("first")))
+
+	loaded, err := s.storage.Load(nickname)
+	s.Require().NoError(err)
+	s.Equal(snapshotOf("first"), loaded)
+
+	nicknames, err := s.storage.List()
+	s.Require().NoError(err)
+	s.Equal([]string{nickname}, nicknames)
+}
+
+func (s *FileStorageSuite) TestList() {
+	nicknames, err := s.storage.List()
+	s.Require().NoError(err)
+	s.Empty(nicknames)
+
+	s.Require().NoError(s.storage.Save("student", snapshotOf("first")))
+	s.Require().NoError(s.storage.Save("teacher/../neighbour", snapshotOf("second")))
+	s.Require().NoError(s.storage.Save("teacher", snapshotOf("third")))
+
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "sandbox-1.tmp"), []byte("{"), 0o600))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "notes.txt"), []byte("notes"), 0o600))
+	s.Require().NoError(os.Mkdir(filepath.Join(s.dir, "nested.json"), 0o700))
+
+	nicknames, err = s.storage.List()
+	s.Require().NoError(err)
+	s.ElementsMatch([]string{"student", "teacher/../neighbour", "teacher"}, nicknames)
+}
+
+func (s *FileStorageSuite) TestListReadsOnlyNicknames() {
+	// the snapshot is cut after the nickname and a lot of data, which List must not need
+	content := `{"nickname": "student", "snapshot": {"products": [` + strings.Repeat(`{"id": "product"},`, 1<<16)
+	s.Require().NoError(os.WriteFile(s.storage.path("student"), []byte(content), 0o600))
+
+	nicknames, err := s.storage.List()
+	s.Require().NoError(err)
+	s.Equal([]string{"student"}, nicknames)
+
+	_, err = s.storage.Load("student")
+	s.Error(err, "the snapshot itself is still parsed whole on load")
+}
+
+func (s *FileStorageSuite) TestCorruptFiles() {
+	s.Require().NoError(s.storage.Save("teacher", snapshotOf("first")))
+	s.Require().NoError(os.WriteFile(s.storage.path("student"), []byte("{"), 0o600))
+
+	_, err := s.storage.Load("student")
+	s.Require().Error(err)
+	s.NotErrorIs(err, models.ErrNotFound)
+
+	nicknames, err := s.storage.List()
+	s.Require().NoError(err)
+	s.Equal([]string{"teacher"}, nicknames, "files without a readable nickname must be skipped")
+}
+
+func (s *FileStorageSuite) fileNames() []string {
+	entries, err := os.ReadDir(s.dir)
+	s.Require().NoError(err)
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+
+	return names
+}
+
+func snapshotOf(productID string) models.SandboxSnapshot {
+	return models.SandboxSnapshot{
+		CreatedAt:           time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC),
+		Products:            []models.Product{{ID: productID, Name: "Ноутбук"}},
+		Feedbacks:           map[string]*models.Feedback{},
+		FeedbacksPerProduct: map[string][]string{},
+	}
+}
@@ -66,3 +66,14 @@ func runServer(
 
 	return nil
 }
+
+// RunWorker runs a background task which must return when ctx is done.
+func RunWorker(ctx context.Context, worker func(ctx context.Context), wgr *sync.WaitGroup) {
+	wgr.Add(1)
+
+	go func() {
+		defer wgr.Done()
+
+		worker(ctx)
+	}()
+}
@@ -59,3 +59,45 @@ func (s *ProductSuite) TestAddProduct() {
 	err = json.Unmarshal(res, &newProductFullInfo)
 	s.NoError(err)
 }
+
+func (s *ProductSuite) TestCreateProduct() {
+	body := []byte(`{"name": "Крем для рук", "article": "1234567890", "category": "Косметика", "price": 350, "oldPrice": 400}`)
+
+	res, code := s.PostAPI("http://localhost:8080", "/api/products", body, nil, nil)
+	s.Equal(http.StatusCreated, code)
+
+	var newProduct models.ProductPreview
+	err := json.Unmarshal(res, &newProduct)
+	s.NoError(err)
+
+	s.NotEmpty(newProduct.ID)
+	s.True(newProduct.IsRemovable)
+	s.NotEmpty(newProduct.ImageURL)
+
+	res, code = s.GetAPI("http://localhost:8080", "/api/products/"+newProduct.ID, nil, nil)
+	s.Equal(http.StatusOK, code)
+
+	var newProductFullInfo models.ProductPageInfo
+	err = json.Unmarshal(res, &newProductFullInfo)
+	s.NoError(err)
+	s.Equal("1234567890", newProductFullInfo.Article)
+}
+
+func (s *ProductSuite) TestCreateProductValidation() {
+	body := []byte(`{"name": "", "article": "123", "category": "Игрушки", "price": 100, "oldPrice": 50}`)
+
+	res, code := s.PostAPI("http://localhost:8080", "/api/products", body, nil, nil)
+	s.Equal(http.StatusBadRequest, code)
+
+	var validationErr struct {
+		Fields map[string]string `json:"fields"`
+	}
+	err := json.Unmarshal(res, &validationErr)
+	s.NoError(err)
+
+	s.Contains(validationErr.Fields, "name")
+	s.Contains(validationErr.Fields, "article")
+	s.Contains(validationErr.Fields, "category")
+	s.Contains(validationErr.Fields, "oldPrice")
+	s.NotContains(validationErr.Fields, "price")
+}